@@ -0,0 +1,150 @@
+package gograte
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MigrationSummary is a heuristic summary of what DDL files do, for
+// reviewers to gauge the risk of a migration at a glance
+type MigrationSummary struct {
+	// File is the path of the analyzed file, "" for a total
+	File string
+	// Statements is the number of statements
+	Statements int
+	// Creates, Alters and Drops count the statements of each kind,
+	// Other counts the remaining statements, e.g. INSERT or GRANT
+	Creates int
+	Alters  int
+	Drops   int
+	Other   int
+	// Indexes is set when a statement creates, alters, drops or
+	// rebuilds an index
+	Indexes bool
+	// Constraints is set when a statement adds, drops or declares a
+	// constraint, e.g. a primary or foreign key
+	Constraints bool
+}
+
+// String returns a one line description of the summary, e.g.
+//
+//	003-orders.sql: 4 statements, 2 create, 1 alter, 1 drop, 0 other, indexes, constraints
+func (s MigrationSummary) String() string {
+	name := s.File
+	if name == "" {
+		name = "total"
+	}
+	str := fmt.Sprintf("%s: %d statements, %d create, %d alter, %d drop, %d other", name, s.Statements, s.Creates, s.Alters, s.Drops, s.Other)
+	if s.Indexes {
+		str += ", indexes"
+	}
+	if s.Constraints {
+		str += ", constraints"
+	}
+	return str
+}
+
+// add adds the counts of o to s
+func (s *MigrationSummary) add(o MigrationSummary) {
+	s.Statements += o.Statements
+	s.Creates += o.Creates
+	s.Alters += o.Alters
+	s.Drops += o.Drops
+	s.Other += o.Other
+	s.Indexes = s.Indexes || o.Indexes
+	s.Constraints = s.Constraints || o.Constraints
+}
+
+// AnalyzeMigration summarizes the DDL file at path by shallow keyword
+// scanning: the file is split into statements (see SplitStatements)
+// and each is classified by its first keyword.
+//
+// It is a heuristic, not a SQL parser. Statements inside DO blocks or
+// functions are counted as the one enclosing statement, and keywords
+// inside string literals or quoted identifiers may be picked up, e.g.
+// a column default of 'check' flags Constraints.
+func AnalyzeMigration(path string) (MigrationSummary, error) {
+	b, err := readSQLFile(path)
+	if err != nil {
+		return MigrationSummary{}, err
+	}
+
+	s := MigrationSummary{File: path}
+	for _, stmt := range SplitStatements(string(b)) {
+		s.add(analyzeStatement(stmt))
+	}
+	return s, nil
+}
+
+// AnalyzeMigrations summarizes each file the migration for the given
+// direction and profile would run (see AnalyzeMigration) and returns
+// the summaries along with their total, an overall impact report for
+// the batch. Nothing is executed.
+func AnalyzeMigrations(up bool, profile string, opts ...Option) (total MigrationSummary, files []MigrationSummary, err error) {
+	var m migration
+	m, err = newMigration(up, profile, opts...)
+	if err != nil {
+		return MigrationSummary{}, nil, err
+	}
+	defer m.close()
+
+	for _, df := range m.files {
+		var s MigrationSummary
+		s, err = AnalyzeMigration(m.dir + "/" + df.filename)
+		if err != nil {
+			return MigrationSummary{}, nil, err
+		}
+		total.add(s)
+		files = append(files, s)
+	}
+	return total, files, nil
+}
+
+// constraintKeywords mark a statement which touches constraints
+var constraintKeywords = map[string]bool{
+	"CONSTRAINT": true,
+	"PRIMARY":    true,
+	"FOREIGN":    true,
+	"REFERENCES": true,
+	"CHECK":      true,
+	"UNIQUE":     true,
+}
+
+// analyzeStatement classifies a single statement
+func analyzeStatement(stmt string) MigrationSummary {
+	words := strings.FieldsFunc(strings.ToUpper(stmt), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+	})
+	if len(words) == 0 {
+		return MigrationSummary{}
+	}
+
+	s := MigrationSummary{Statements: 1}
+	switch words[0] {
+	case "CREATE":
+		s.Creates = 1
+	case "ALTER":
+		s.Alters = 1
+	case "DROP":
+		s.Drops = 1
+	case "REINDEX":
+		s.Other = 1
+		s.Indexes = true
+	default:
+		s.Other = 1
+	}
+
+	for _, w := range words {
+		if w == "INDEX" && (s.Creates+s.Alters+s.Drops) > 0 {
+			s.Indexes = true
+		}
+	}
+	// UNIQUE in CREATE UNIQUE INDEX is part of the index
+	for _, w := range words {
+		if constraintKeywords[w] && !(w == "UNIQUE" && s.Indexes) {
+			s.Constraints = true
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,182 @@
+package gograte
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isArchive reports whether the migration scripts location is a .zip
+// or .tar.gz archive rather than a directory
+func isArchive(p string) bool {
+	return strings.HasSuffix(p, ".zip") || strings.HasSuffix(p, ".tar.gz") || strings.HasSuffix(p, ".tgz")
+}
+
+// migrationDir returns the directory holding the up or down DDL files
+// for the config, for the suffix layout the directory holding both.
+// Down files are read from downScriptsDir when it is configured, which
+// may be missing when allowEmptyDown is set. When
+// migrationScriptsDir is an archive, the files for the direction are
+// extracted to a new temporary directory, which is returned so psql
+// can run them. The returned cleanup func removes the temporary
+// directory and must be called once the files are no longer needed,
+// it does nothing when no archive was extracted.
+func migrationDir(f ConfigFile, up bool) (dir string, cleanup func(), err error) {
+	if dir = f.downDir(); !up && dir != "" {
+		_, err = os.Stat(dir)
+		if err != nil {
+			if os.IsNotExist(err) && f.Config.AllowEmptyDown {
+				// reading it reports there are no down files
+				return dir, func() {}, nil
+			}
+			if os.IsNotExist(err) {
+				return "", nil, fmt.Errorf("downScriptsDir %q does not exist: %w", dir, err)
+			}
+			return "", nil, err
+		}
+		return dir, func() {}, nil
+	}
+
+	sub := "down"
+	if up {
+		sub = "up"
+	}
+	if f.Config.Layout == SuffixLayout {
+		// up and down files share the directory
+		sub = "."
+	}
+
+	_, err = os.Stat(f.Config.MigrationScriptsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("migrationScriptsDir %q does not exist: %w", f.Config.MigrationScriptsDir, err)
+		}
+		return "", nil, err
+	}
+
+	if !isArchive(f.Config.MigrationScriptsDir) {
+		if sub == "." {
+			return f.scriptsDir(), func() {}, nil
+		}
+		return f.scriptsDir() + "/" + sub, func() {}, nil
+	}
+
+	// a component's files are under its directory in the archive
+	if f.Config.Component != "" {
+		sub = path.Join(f.Config.Component, sub)
+	}
+
+	return extractArchive(f.Config.MigrationScriptsDir, sub, f.namingScheme())
+}
+
+// extractArchive extracts the DDL files found in the sub directory
+// (up or down) at the root of the archive to a temporary directory.
+// Entry names are validated against the DDL file naming convention.
+// The returned cleanup func removes the temporary directory.
+func extractArchive(archivePath, sub, namingScheme string) (dir string, cleanup func(), err error) {
+	dir, err = os.MkdirTemp("", "gograte-"+strings.NewReplacer("/", "-", ".", "files").Replace(sub)+"-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { _ = os.RemoveAll(dir) }
+
+	extract := func(name string, r io.Reader) error {
+		name = path.Clean(name)
+		if path.Dir(name) != sub {
+			return nil
+		}
+		base := path.Base(name)
+		if _, err := parseDDLFile(base, namingScheme); err != nil {
+			return fmt.Errorf("%s: invalid DDL file name %q: %w", archivePath, name, err)
+		}
+		out, err := os.Create(filepath.Join(dir, base))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	if strings.HasSuffix(archivePath, ".zip") {
+		err = extractZip(archivePath, extract)
+	} else {
+		err = extractTarGz(archivePath, extract)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return dir, cleanup, nil
+}
+
+// extractZip calls fn for each regular file in the zip archive
+func extractZip(archivePath string, fn func(name string, r io.Reader) error) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		var rc io.ReadCloser
+		rc, err = zf.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(zf.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTarGz calls fn for each regular file in the gzipped tar archive
+func extractTarGz(archivePath string, fn func(name string, r io.Reader) error) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var gz *gzip.Reader
+	gz, err = gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = fn(hdr.Name, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
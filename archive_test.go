@@ -0,0 +1,82 @@
+package gograte
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip writes a zip archive holding a trivial statement in each
+// named file and returns its path
+func writeZip(t *testing.T, names ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "migrations.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte("select 1;\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = out.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestArchiveExtractionIsRemoved(t *testing.T) {
+	archive := writeZip(t, "up/001-a.sql", "up/002-b.sql", "down/001-a.sql", "down/002-b.sql")
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.MigrationScriptsDir = archive
+	})
+	tmp := emptyTempDir(t)
+
+	args, err := PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := fileArgsOrder(args); len(files) != 2 {
+		t.Fatalf("got files %q, want the 2 archived up files", files)
+	}
+	assertNoLeftovers(t, tmp)
+
+	_, err = Verify(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoLeftovers(t, tmp)
+
+	err = EnsurePaired(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoLeftovers(t, tmp)
+}
+
+func TestArchiveExtractionIsRemovedOnError(t *testing.T) {
+	archive := writeZip(t, "up/001-a.sql", "down/001-a.sql")
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.MigrationScriptsDir = archive
+	})
+	tmp := emptyTempDir(t)
+
+	_, err := PSQLArgs(true, testProfile, WithGlob("*-missing.sql"))
+	if err == nil {
+		t.Fatal("no error when no file matches the glob")
+	}
+	assertNoLeftovers(t, tmp)
+}
@@ -0,0 +1,76 @@
+package gograte
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identPattern matches an optionally schema qualified, optionally
+// double quoted, identifier
+const identPattern = `((?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_$]*)(?:\.(?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_$]*))?)`
+
+// reversible maps the statements AutoDown understands to the format
+// of the statement which reverses them
+var reversible = []struct {
+	re   *regexp.Regexp
+	down string
+}{
+	{regexp.MustCompile(`(?is)^create\s+(?:(?:global\s+|local\s+)?(?:temporary|temp)\s+|unlogged\s+)?table\s+(?:if\s+not\s+exists\s+)?` + identPattern + `\s*\(`), "DROP TABLE IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^create\s+(?:unique\s+)?index\s+(?:concurrently\s+)?(?:if\s+not\s+exists\s+)?` + identPattern + `\s+on\s`), "DROP INDEX IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^create\s+(?:or\s+replace\s+)?view\s+` + identPattern + `\s`), "DROP VIEW IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^create\s+sequence\s+(?:if\s+not\s+exists\s+)?` + identPattern + `(?:\s|$)`), "DROP SEQUENCE IF EXISTS %s;"},
+}
+
+// AutoDown generates the content of a down file for the up file at
+// upFile. Only simple, unambiguous statements are reversed:
+//
+//	CREATE TABLE foo (...)      -> DROP TABLE IF EXISTS foo;
+//	CREATE INDEX foo_idx ON ... -> DROP INDEX IF EXISTS foo_idx;
+//	CREATE VIEW foo AS ...      -> DROP VIEW IF EXISTS foo;
+//	CREATE SEQUENCE foo         -> DROP SEQUENCE IF EXISTS foo;
+//
+// Statements are reversed in the opposite order they appear. If the
+// file contains any other statement an error naming it is returned,
+// rather than guessing at how to reverse it.
+func AutoDown(upFile string) (string, error) {
+	b, err := readSQLFile(upFile)
+	if err != nil {
+		return "", err
+	}
+
+	statements := SplitStatements(string(b))
+	if len(statements) == 0 {
+		return "", fmt.Errorf("%s has no statements to reverse", upFile)
+	}
+
+	downs := make([]string, 0, len(statements))
+	for _, stmt := range statements {
+		var down string
+		for _, r := range reversible {
+			if m := r.re.FindStringSubmatch(stmt); m != nil {
+				down = fmt.Sprintf(r.down, m[1])
+				break
+			}
+		}
+		if down == "" {
+			return "", fmt.Errorf("%s: cannot safely reverse statement: %s", upFile, firstLine(stmt))
+		}
+		downs = append(downs, down)
+	}
+
+	// reverse so dependent objects (e.g. indexes) are dropped first
+	for i, j := 0, len(downs)-1; i < j; i, j = i+1, j-1 {
+		downs[i], downs[j] = downs[j], downs[i]
+	}
+
+	return strings.Join(downs, "\n") + "\n", nil
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[:i]
+	}
+	return s
+}
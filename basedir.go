@@ -0,0 +1,48 @@
+package gograte
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// validateBaseDir ensures a base directory set with WithBaseDir is
+// absolute, as it must not depend on the working directory
+func validateBaseDir(baseDir string) error {
+	if baseDir != "" && !filepath.IsAbs(baseDir) {
+		return fmt.Errorf("base directory %q must be absolute", baseDir)
+	}
+	return nil
+}
+
+// inBaseDir returns p within baseDir when baseDir is set and p is a
+// relative file path, otherwise p as is
+func inBaseDir(baseDir, p string) string {
+	if baseDir == "" || p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	if _, ok := remoteConfigURL(p); ok {
+		return p
+	}
+	return filepath.Join(baseDir, p)
+}
+
+// profilePath returns the path of the JSON config file for profile in
+// ConfigDir, within baseDir if set
+func profilePath(baseDir, profile string) string {
+	return inBaseDir(baseDir, ConfigDir()) + "/" + profile + ".json"
+}
+
+// resolvePaths makes the relative paths in f relative to baseDir
+// instead of the working directory. It runs after validateScriptsDir,
+// which checks the paths as written.
+func (f *ConfigFile) resolvePaths(baseDir string) {
+	if baseDir == "" {
+		return
+	}
+	f.configDir = inBaseDir(baseDir, ConfigDir())
+	f.Config.MigrationScriptsDir = inBaseDir(baseDir, f.Config.MigrationScriptsDir)
+	f.Config.DownScriptsDir = inBaseDir(baseDir, f.Config.DownScriptsDir)
+	if m := f.Config.Tracking.Manifest; m != "default" {
+		f.Config.Tracking.Manifest = inBaseDir(baseDir, m)
+	}
+}
@@ -0,0 +1,123 @@
+package gograte
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MarkApplied records the up files numbered 1 through upTo as applied
+// in the tracking table without running them, all in one new batch.
+// It is used to adopt gograte on a database which already has the
+// schema those files would create (a baseline), so that subsequent up
+// runs only apply newer files.
+//
+// Files which are already recorded are skipped, so marking twice is
+// harmless. The newly marked files are returned. Tracking must be
+// enabled in the profile's config.
+func MarkApplied(profile string, upTo int, opts ...Option) ([]MigrationFile, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return nil, err
+	}
+	err = requireTrackingTable(f, profile, "marking files as applied")
+	if err != nil {
+		return nil, err
+	}
+	if upTo < 1 {
+		return nil, fmt.Errorf("invalid file number %d: must be at least 1", upTo)
+	}
+
+	var t Tracker
+	t, err = NewTracker(f)
+	if err != nil {
+		return nil, err
+	}
+	var closeTunnel func()
+	t.DSN, closeTunnel, err = tunnelDSN(f)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTunnel()
+
+	var (
+		dir     string
+		cleanup func()
+	)
+	dir, cleanup, err = migrationDir(f, true)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var dirty string
+	dirty, err = t.Dirty()
+	if err != nil {
+		return nil, err
+	}
+	if dirty != "" {
+		return nil, fmt.Errorf("%w: %s failed in a previous run, fix it and resume", ErrDirty, dirty)
+	}
+
+	var applied map[int]bool
+	applied, err = t.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var toMark []ddlFile
+	for _, df := range ddlFiles {
+		if df.fileNumber > upTo || applied[df.fileNumber] {
+			continue
+		}
+		if df.dotted() {
+			return nil, fmt.Errorf("%s: dotted versions cannot be recorded in the tracking table", df.filename)
+		}
+		toMark = append(toMark, df)
+	}
+	if len(toMark) == 0 {
+		return nil, fmt.Errorf("%w: files up to %d in %s are already recorded", ErrNoMigrations, upTo, dir)
+	}
+
+	var batch int
+	batch, err = t.nextBatch()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(toMark))
+	for _, df := range toMark {
+		values = append(values, fmt.Sprintf("(%d, %s, %d, false)", df.fileNumber, quoteLiteral(df.filename), batch))
+	}
+	// psql runs the statements of a single -c in one transaction
+	sql := t.createTableSQL() + "; " + fmt.Sprintf("insert into %s (file_number, filename, batch, dirty) values %s", t.table(), strings.Join(values, ", "))
+	_, err = queryPSQL(t.DSN, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	marked := make([]MigrationFile, 0, len(toMark))
+	for _, df := range toMark {
+		marked = append(marked, newMigrationFile(df, dir))
+	}
+
+	return marked, nil
+}
+
+// aboveBaseline returns the files numbered above baseline, those at or
+// below it are assumed to be applied already (see baselineVersion)
+func aboveBaseline(ddlFiles []ddlFile, baseline int) []ddlFile {
+	var above []ddlFile
+	for _, df := range ddlFiles {
+		if df.fileNumber > baseline {
+			above = append(above, df)
+		}
+	}
+	return above
+}
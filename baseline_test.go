@@ -0,0 +1,100 @@
+package gograte
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestArgsBaselineVersion(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.BaselineVersion = 2
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql", "004-d.sql")
+	writeFiles(t, scriptsDir+"/down", "001-a.sql", "002-b.sql", "003-c.sql", "004-d.sql")
+
+	tests := []struct {
+		up   bool
+		want []string
+	}{
+		{up: true, want: []string{"003-c.sql", "004-d.sql"}},
+		{up: false, want: []string{"004-d.sql", "003-c.sql"}},
+	}
+	for _, tt := range tests {
+		args, err := PSQLArgs(tt.up, testProfile)
+		if err != nil {
+			t.Fatalf("up=%t: %v", tt.up, err)
+		}
+		if got := fileArgsOrder(args); !slices.Equal(got, tt.want) {
+			t.Errorf("up=%t: files = %q, want %q", tt.up, got, tt.want)
+		}
+	}
+}
+
+func TestBaselineVersionCoversAllFiles(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.BaselineVersion = 2
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+
+	_, err := PSQLArgs(true, testProfile)
+	if !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("err = %v, want ErrNoMigrations", err)
+	}
+}
+
+func TestBaselineVersionWithoutTrackingRows(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.BaselineVersion = 2
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	// nothing is recorded, as on a database which predates gograte
+	answerQueries(t,
+		[2]string{"select exists", "f"},
+	)
+
+	pending, err := HasPending(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending {
+		t.Error("HasPending = false, want true with 003-c.sql not applied")
+	}
+
+	err = Run(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ran []string
+	for _, call := range psqlCalls(t, log) {
+		ran = append(ran, fileArgsOrder(call)...)
+	}
+	if !slices.Equal(ran, []string{"003-c.sql"}) {
+		t.Errorf("ran %q, want only 003-c.sql above the baseline", ran)
+	}
+}
+
+func TestBaselineVersionNothingPending(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.BaselineVersion = 2
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where not dirty", "3"},
+	)
+
+	pending, err := HasPending(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending {
+		t.Error("HasPending = true, want false with the files at or below the baseline unrecorded")
+	}
+}
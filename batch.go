@@ -0,0 +1,86 @@
+package gograte
+
+import (
+	"context"
+	"fmt"
+)
+
+// RollbackBatch runs the down files for the migrations applied by the
+// most recent up run (batch) recorded in the tracking table, in
+// descending file number order. Each file's tracking row is removed as
+// soon as its down file succeeds and execution stops on the first
+// error, so a failed rollback leaves the remaining files recorded.
+// When transactions are enabled for the down direction, the whole
+// batch is rolled back in one transaction instead.
+//
+// The rollback is resolved and run like any down migration (see
+// RunContext), so a dirty database is refused and the session
+// settings, SSH tunnel and destructive statement confirmation apply.
+//
+// Tracking must be enabled in the profile's config.
+func RollbackBatch(profile string, opts ...Option) error {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+	err = requireTrackingTable(f, profile, "rolling back a batch")
+	if err != nil {
+		return err
+	}
+
+	return RunContext(context.Background(), false, profile, append(opts, withLastBatch())...)
+}
+
+// lastBatchFiles returns the files in ddlFiles which were applied by
+// the most recent batch. Every file in the batch must have a down file
+// in ddlFiles.
+func (t Tracker) lastBatchFiles(ddlFiles []ddlFile, dir string) ([]ddlFile, error) {
+	batch, err := t.lastBatch()
+	if err != nil {
+		return nil, err
+	}
+	if batch == 0 {
+		return nil, fmt.Errorf("%w: no batches recorded in %s", ErrNoMigrations, t.table())
+	}
+
+	var inBatch map[int]bool
+	inBatch, err = t.batchFiles(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	var batchFiles []ddlFile
+	for _, df := range ddlFiles {
+		if inBatch[df.fileNumber] {
+			batchFiles = append(batchFiles, df)
+		}
+	}
+	if len(batchFiles) != len(inBatch) {
+		return nil, fmt.Errorf("batch %d has %d applied files but only %d down files were found in %s", batch, len(inBatch), len(batchFiles), dir)
+	}
+
+	return batchFiles, nil
+}
+
+// Resume continues an up migration which failed. The file recorded as
+// dirty (failed) in the tracking table is run again, presumably after
+// it has been fixed, followed by the remaining pending files in order.
+// Files which were already applied are not run again and the dirty
+// flag is cleared when the failed file succeeds. The run is otherwise
+// like any up migration (see RunContext).
+//
+// Tracking must be enabled in the profile's config.
+func Resume(profile string, opts ...Option) error {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+	err = requireTrackingTable(f, profile, "resuming")
+	if err != nil {
+		return err
+	}
+
+	return RunContext(context.Background(), true, profile, append(opts, withResume())...)
+}
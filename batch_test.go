@@ -0,0 +1,126 @@
+package gograte
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRollbackBatchRunsLastBatchDownFiles(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.PSQL.ClientMinMessages = "warning"
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	writeFiles(t, scriptsDir+"/down", "001-a.sql", "002-b.sql", "003-c.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where not dirty", `1\n2\n3`},
+		[2]string{"max(batch)", "2"},
+		[2]string{"where batch = 2", `2\n3`},
+	)
+
+	err := RollbackBatch(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := psqlCalls(t, log)
+	run := calls[len(calls)-1]
+	var ran []string
+	for _, f := range fileArgsOrder(run) {
+		ran = append(ran, f[strings.LastIndex(f, "/")+1:])
+	}
+	if want := []string{"003-c.sql", "002-b.sql"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran %q, want %q", ran, want)
+	}
+	for _, n := range []string{"2", "3"} {
+		if indexOf(run, "-c", "delete from schema_migrations where file_number = "+n) == -1 {
+			t.Errorf("tracking row of file %s is not removed: %q", n, run)
+		}
+	}
+	if indexOf(run, "-c", "SET client_min_messages = warning") == -1 {
+		t.Errorf("session settings are not applied: %q", run)
+	}
+}
+
+func TestRollbackBatchRefusesDirtyDatabase(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+	})
+	writeFiles(t, scriptsDir+"/down", "001-a.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where dirty order by", "001-a.sql"},
+	)
+
+	err := RollbackBatch(testProfile)
+	if err == nil || !strings.Contains(err.Error(), "dirty") {
+		t.Fatalf("err = %v, want the dirty database refused", err)
+	}
+}
+
+func TestRollbackBatchWithBaseDir(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+	writeFiles(t, scriptsDir+"/down", "001-a.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where not dirty", "1"},
+		[2]string{"max(batch)", "1"},
+		[2]string{"where batch = 1", "1"},
+	)
+	// the config is only found within the base directory
+	t.Setenv("GOGRATE_CONFIG_DIR", "config")
+	t.Chdir(t.TempDir())
+
+	err := RollbackBatch(testProfile, WithBaseDir(filepath.Dir(scriptsDir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := psqlCalls(t, log)
+	run := calls[len(calls)-1]
+	if indexOf(run, "-c", "delete from schema_migrations where file_number = 1") == -1 {
+		t.Errorf("batch 1 is not rolled back: %q", run)
+	}
+}
+
+func TestResumeRunsFromDirtyFile(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.PSQL.ClientMinMessages = "warning"
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where dirty order by", "002-b.sql"},
+		[2]string{"where not dirty", "1"},
+		[2]string{"max(batch)", "1"},
+	)
+
+	err := Resume(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := psqlCalls(t, log)
+	run := calls[len(calls)-1]
+	var ran []string
+	for _, f := range fileArgsOrder(run) {
+		ran = append(ran, f[strings.LastIndex(f, "/")+1:])
+	}
+	if want := []string{"002-b.sql", "003-c.sql"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran %q, want %q", ran, want)
+	}
+	if indexOf(run, "-c", "SET client_min_messages = warning") == -1 {
+		t.Errorf("session settings are not applied: %q", run)
+	}
+}
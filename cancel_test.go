@@ -0,0 +1,60 @@
+package gograte
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunContextCancelledMidBatch(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.SingleTransaction = true
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	t.Setenv("FAKEPSQL_HANG", "002-b.sql")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- RunContext(ctx, true, testProfile) }()
+
+	// cancel once psql is inside the second file, like Ctrl-C would
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(log)
+		if strings.Contains(string(b), "hanging") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("psql did not reach the second file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after cancellation")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if !strings.Contains(out, "SIGTERM") {
+		t.Error("psql was not sent SIGTERM, so its transaction may not be rolled back")
+	}
+	if strings.Contains(out, "003-c.sql") || strings.Contains(out, "COMMIT") {
+		t.Errorf("psql went on past the interrupted file:\n%s", out)
+	}
+}
@@ -0,0 +1,196 @@
+package gograte
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// states of an up file reported by Preview
+const (
+	// FileApplied is an up file recorded as applied, unchanged since
+	FileApplied = "applied"
+	// FilePending is an up file which has not been applied
+	FilePending = "pending"
+	// FileModified is an up file recorded as applied whose content
+	// has changed since, which usually means an applied migration
+	// was edited and the database does not match the file
+	FileModified = "modified"
+)
+
+// FilePreview describes an up file and its state in the database
+type FilePreview struct {
+	MigrationFile
+	// State is FileApplied, FilePending or FileModified
+	State string
+	// Checksum is the SHA-256 of the file on disk
+	Checksum string
+	// AppliedChecksum is the SHA-256 recorded when the file was
+	// applied, "" if it was not applied or was recorded without one
+	AppliedChecksum string
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the file at path
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Preview returns every up file for the given profile with its state:
+// applied, pending, or modified when the checksum recorded at apply
+// time no longer matches the file. Files applied without a recorded
+// checksum (e.g. by an older version, or with MarkApplied) are
+// reported as applied. Nothing is executed.
+func Preview(profile string, opts ...Option) ([]FilePreview, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Tracker
+	t, err = NewTracker(f)
+	if err != nil {
+		return nil, err
+	}
+	var closeTunnel func()
+	t.DSN, closeTunnel, err = tunnelDSN(f)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTunnel()
+
+	var (
+		dir     string
+		cleanup func()
+	)
+	dir, cleanup, err = migrationDir(f, true)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var applied map[int]string
+	if path := f.manifestPath(); path != "" {
+		var tm trackingManifest
+		tm, err = readManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		applied = make(map[int]string, len(tm.Applied))
+		for _, e := range tm.Applied {
+			applied[e.FileNumber] = e.Checksum
+		}
+	} else {
+		applied, err = t.appliedChecksums()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	previews := make([]FilePreview, 0, len(ddlFiles))
+	for _, df := range ddlFiles {
+		p := FilePreview{MigrationFile: newMigrationFile(df, dir), State: FilePending}
+		p.Checksum, err = fileChecksum(dir + "/" + df.filename)
+		if err != nil {
+			return nil, err
+		}
+		if sum, ok := applied[df.fileNumber]; ok {
+			p.State = FileApplied
+			p.AppliedChecksum = sum
+			if sum != "" && sum != p.Checksum {
+				p.State = FileModified
+			}
+		}
+		previews = append(previews, p)
+	}
+
+	return previews, nil
+}
+
+// addChecksumSQL returns the statement which adds the checksum column
+// to a tracking table created before checksums were recorded
+func (t Tracker) addChecksumSQL() string {
+	return fmt.Sprintf("alter table %s add column if not exists checksum text", t.table())
+}
+
+// appliedChecksums returns the checksum recorded for each applied
+// file, "" where none was recorded. An empty map is returned if the
+// tracking table does not exist yet.
+func (t Tracker) appliedChecksums() (map[int]string, error) {
+	ok, err := t.Exists()
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[int]string)
+	if !ok {
+		return checksums, nil
+	}
+
+	// a table from an older version has no checksum column until the
+	// next migration runs its setup
+	checksum := "''"
+	ok, err = t.hasColumn("checksum")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		checksum = "coalesce(checksum, '')"
+	}
+
+	var rows [][]string
+	rows, err = queryPSQL(t.DSN, fmt.Sprintf("select file_number, %s from %s where not dirty", checksum, t.table()))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		var n int
+		n, err = strconv.Atoi(row[0])
+		if err != nil {
+			return nil, err
+		}
+		var sum string
+		if len(row) > 1 {
+			sum = row[1]
+		}
+		checksums[n] = sum
+	}
+
+	return checksums, nil
+}
+
+// hasColumn reports whether the tracking table has the named column
+func (t Tracker) hasColumn(column string) (bool, error) {
+	schemaCond := "table_schema = any(current_schemas(false))"
+	table := t.table()
+	if i := strings.Index(table, "."); i != -1 {
+		schemaCond = "table_schema = " + quoteLiteral(table[:i])
+		table = table[i+1:]
+	}
+
+	rows, err := queryPSQL(t.DSN, fmt.Sprintf("select exists (select 1 from information_schema.columns where %s and table_name = %s and column_name = %s)", schemaCond, quoteLiteral(table), quoteLiteral(column)))
+	if err != nil {
+		return false, err
+	}
+	return len(rows) == 1 && rows[0][0] == "t", nil
+}
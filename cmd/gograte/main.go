@@ -0,0 +1,182 @@
+// Command gograte runs gograte migrations without mage.
+//
+// Install it with go install github.com/gilcrest/gograte/cmd/gograte@latest
+// and run it from the project root, e.g.
+//
+//	gograte up --profile default
+//	gograte down --profile default
+//	gograte up --profile default --host db.example.com --db scratch --user admin
+//	gograte status --profile default
+//	gograte status --profile default --verbose
+//	gograte new --profile default --name add_users
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gilcrest/gograte"
+)
+
+const usage = `usage: gograte <command> [flags]
+
+commands:
+  up      run the DDL files in the up directory
+  down    run the DDL files in the down directory
+  status  print the current schema version and pending migrations
+  new     create an empty up and down file pair
+  env     print the connection as libpq environment variables,
+          e.g. eval $(gograte env --profile default)
+
+run gograte <command> -h for the flags of a command
+`
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gograte:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the command and its flags from args and runs it
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("no command given")
+	}
+
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	profile := fs.String("profile", "default", "config profile, a matching json file is expected in the config directory")
+
+	switch cmd {
+	case "up", "down":
+		tag := fs.String("tag", "", "only run files tagged with this tag in a gograte:tags header")
+		expectHash := fs.String("expect-hash", "", "abort unless the hash of the files to run matches, see GOGRATE_EXPECTED_HASH")
+		var c gograte.ConnectionOverride
+		fs.StringVar(&c.Host, "host", "", "database host, overriding the profile; the password is then taken from PGPASSWORD or the password file")
+		fs.IntVar(&c.Port, "port", 0, "database port, overriding the profile")
+		fs.StringVar(&c.Database, "db", "", "database name, overriding the profile")
+		fs.StringVar(&c.User, "user", "", "database user, overriding the profile")
+		err := fs.Parse(args)
+		if err != nil {
+			return err
+		}
+		var opts []gograte.Option
+		if c != (gograte.ConnectionOverride{}) {
+			var dsn gograte.PostgreSQLDSN
+			dsn, err = gograte.BuildDSNWithOverride(*profile, c)
+			if err != nil {
+				return err
+			}
+			fmt.Println("connecting to", dsn.Redacted())
+			opts = append(opts, gograte.WithConnectionOverride(c))
+		}
+		if *tag != "" {
+			opts = append(opts, gograte.WithTag(*tag))
+		}
+		if *expectHash != "" {
+			opts = append(opts, gograte.WithExpectedHash(*expectHash))
+		}
+		// Ctrl-C stops psql, rolling back its open transaction
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = gograte.RunContext(ctx, cmd == "up", *profile, opts...)
+		if errors.Is(err, gograte.ErrNoMigrations) {
+			fmt.Println(err)
+			return nil
+		}
+		return err
+	case "status":
+		verbose := fs.Bool("verbose", false, "also list the full path, size and modification time of each file an up run would execute")
+		err := fs.Parse(args)
+		if err != nil {
+			return err
+		}
+		return status(*profile, *verbose)
+	case "new":
+		name := fs.String("name", "", "name of the migration, e.g. add_users")
+		err := fs.Parse(args)
+		if err != nil {
+			return err
+		}
+		var upPath, downPath string
+		upPath, downPath, err = gograte.NewMigrationFiles(*profile, *name)
+		if err != nil {
+			return err
+		}
+		fmt.Println("created", upPath)
+		fmt.Println("created", downPath)
+		return nil
+	case "env":
+		err := fs.Parse(args)
+		if err != nil {
+			return err
+		}
+		var dsn gograte.PostgreSQLDSN
+		dsn, err = gograte.BuildDSN(*profile)
+		if err != nil {
+			return err
+		}
+		for _, line := range dsn.EnvExports() {
+			fmt.Println("export " + line)
+		}
+		return nil
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// status prints the migration status for profile and, if verbose,
+// the files an up run would execute
+func status(profile string, verbose bool) error {
+	s, err := gograte.Status(profile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("psql version: %s\n", s.PSQLVersion)
+	fmt.Printf("current version: %d\n", s.CurrentVersion)
+	fmt.Printf("pending: %d\n", len(s.Pending))
+	for _, mf := range s.Pending {
+		fmt.Printf("  %s", mf.Filename)
+		if mf.Author != "" {
+			fmt.Printf("  author: %s", mf.Author)
+		}
+		if mf.Ticket != "" {
+			fmt.Printf("  ticket: %s", mf.Ticket)
+		}
+		if len(mf.Tags) > 0 {
+			fmt.Printf("  tags: %s", strings.Join(mf.Tags, ","))
+		}
+		fmt.Println()
+	}
+
+	if !verbose || len(s.Pending) == 0 {
+		return nil
+	}
+
+	var infos []gograte.MigrationFileInfo
+	infos, err = gograte.ListMigrations(true, profile)
+	if err != nil {
+		return err
+	}
+	fmt.Println("files:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, mfi := range infos {
+		fmt.Fprintf(w, "  %s\t%d bytes\t%s\n", mfi.AbsPath, mfi.Size, mfi.ModTime.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
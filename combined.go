@@ -0,0 +1,197 @@
+package gograte
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CombinedSQL returns the SQL text of every file the migration for the
+// given direction and profile would run, in execution order, as one
+// blob. Each file's content is preceded by a separator comment, e.g.
+//
+//	-- file: 003-user.sql
+//
+// Nothing is executed, which makes this useful for producing a single
+// reviewable artifact. opts restrict the files the same way they do
+// for PSQLArgs.
+//
+// When template is enabled in the config, the rendered SQL is returned.
+// The whole blob is held in memory, use WriteCombinedSQL for
+// migrations with very large files.
+func CombinedSQL(up bool, profile string, opts ...Option) (string, error) {
+	var b strings.Builder
+	err := WriteCombinedSQL(&b, up, profile, opts...)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// WriteCombinedSQL writes the same content as CombinedSQL to w,
+// streaming each file rather than reading it whole, so memory use
+// stays bounded when files are hundreds of MB (e.g. bulk data loads).
+// Files rendered as templates are the exception, they are read whole.
+func WriteCombinedSQL(w io.Writer, up bool, profile string, opts ...Option) error {
+	m, err := newMigration(up, profile, opts...)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+
+	return writeCombinedFiles(w, m.config, m.dir, m.files)
+}
+
+// DownRangeScript returns the down files numbered from through to,
+// inclusive, combined into one script in the order a rollback runs
+// them (descending), with the same separators as CombinedSQL. It is
+// meant for preparing and reviewing a targeted rollback, e.g. of the
+// files which added a feature being removed. Nothing is executed and
+// the tracking table is not consulted. Both from and to, which may be
+// given in either order, must have a down file.
+func DownRangeScript(profile string, from, to int, opts ...Option) (string, error) {
+	o := newOptions(opts)
+	if from > to {
+		from, to = to, from
+	}
+
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		dir     string
+		cleanup func()
+	)
+	dir, cleanup, err = migrationDir(f, false)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(false))
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		inRange        []ddlFile
+		hasFrom, hasTo bool
+	)
+	for _, df := range ddlFiles {
+		if df.fileNumber < from || df.fileNumber > to {
+			continue
+		}
+		hasFrom = hasFrom || df.fileNumber == from
+		hasTo = hasTo || df.fileNumber == to
+		inRange = append(inRange, df)
+	}
+	var problems []string
+	if !hasFrom {
+		problems = append(problems, fmt.Sprintf("no down file numbered %d", from))
+	}
+	if !hasTo && to != from {
+		problems = append(problems, fmt.Sprintf("no down file numbered %d", to))
+	}
+	err = problemsError(fmt.Sprintf("invalid range %d to %d in %s", from, to, dir), problems)
+	if err != nil {
+		return "", err
+	}
+	sort.Sort(sort.Reverse(byFileNumber(inRange)))
+
+	var b strings.Builder
+	err = writeCombinedFiles(&b, f, dir, inRange)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeCombinedFiles writes each of ddlFiles, found in dir, to w
+// preceded by a separator comment
+func writeCombinedFiles(w io.Writer, f ConfigFile, dir string, ddlFiles []ddlFile) error {
+	for i, df := range ddlFiles {
+		var err error
+		if i > 0 {
+			_, err = io.WriteString(w, "\n")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "-- file: "+df.filename+"\n")
+		if err != nil {
+			return err
+		}
+		path := dir + "/" + df.filename
+		if f.Config.Template.Enabled {
+			err = copyRenderedSQLFile(w, f, path)
+		} else {
+			err = copySQLFile(w, path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copySQLFile streams the decoded content of the DDL file at path to
+// w, adding a trailing newline if the content does not end with one
+func copySQLFile(w io.Writer, path string) error {
+	r, err := openSQLFile(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	lw := &lastByteWriter{w: w}
+	_, err = io.Copy(lw, r)
+	if err != nil {
+		return err
+	}
+	if lw.n > 0 && lw.last != '\n' {
+		_, err = io.WriteString(w, "\n")
+	}
+	return err
+}
+
+// copyRenderedSQLFile writes the DDL file at path, rendered as a
+// template, to w, adding a trailing newline if the content does not
+// end with one
+func copyRenderedSQLFile(w io.Writer, f ConfigFile, path string) error {
+	b, err := readSQLFile(path)
+	if err != nil {
+		return err
+	}
+	b, err = f.renderSQL(path, b)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// lastByteWriter passes writes through to w, remembering the number
+// of bytes and the last byte written
+type lastByteWriter struct {
+	w    io.Writer
+	n    int64
+	last byte
+}
+
+// Write writes p to the underlying writer
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.n += int64(n)
+		lw.last = p[n-1]
+	}
+	return n, err
+}
@@ -0,0 +1,144 @@
+package gograte
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// largeFileSize is the size of the synthetic bulk data load file,
+// well above the memory the streaming readers are allowed to use
+const largeFileSize = 64 << 20
+
+// writeLargeFile writes a file of about largeFileSize bytes of insert
+// statements to path and returns the SHA-256 digest of its content
+func writeLargeFile(t *testing.T, path string) []byte {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	w := io.MultiWriter(file, h)
+	var chunk bytes.Buffer
+	for i := 0; chunk.Len() < 1<<20; i++ {
+		fmt.Fprintf(&chunk, "insert into bulk values (%d, 'row %d');\n", i, i)
+	}
+	for written := 0; written < largeFileSize; written += chunk.Len() {
+		_, err = w.Write(chunk.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// allocated returns the bytes allocated on the heap while running fn
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestWriteCombinedSQLLargeFile(t *testing.T) {
+	scriptsDir := newTestProject(t, nil)
+	want := writeLargeFile(t, scriptsDir+"/up/001-bulk-load.sql")
+
+	h := sha256.New()
+	// the header line is checked separately, only the file content is hashed
+	var header bytes.Buffer
+	var err error
+	alloc := allocated(func() {
+		err = WriteCombinedSQL(&headerSplitter{header: &header, rest: h}, true, testProfile)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.String() != "-- file: 001-bulk-load.sql\n" {
+		t.Errorf("header = %q, want the file name comment", header.String())
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		t.Errorf("combined content differs from the file")
+	}
+	if alloc > largeFileSize/8 {
+		t.Errorf("WriteCombinedSQL allocated %d bytes for a %d byte file", alloc, largeFileSize)
+	}
+}
+
+// headerSplitter writes the first line written to it to header and
+// everything after it to rest
+type headerSplitter struct {
+	header *bytes.Buffer
+	rest   io.Writer
+	done   bool
+}
+
+// Write splits p between the header and rest
+func (s *headerSplitter) Write(p []byte) (int, error) {
+	n := len(p)
+	if !s.done {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			s.header.Write(p)
+			return n, nil
+		}
+		s.header.Write(p[:i+1])
+		p = p[i+1:]
+		s.done = true
+	}
+	_, err := s.rest.Write(p)
+	return n, err
+}
+
+func TestMigrationSetHashLargeFile(t *testing.T) {
+	dir := t.TempDir()
+	writeLargeFile(t, dir+"/001-bulk-load.sql")
+
+	var err error
+	alloc := allocated(func() {
+		_, err = MigrationSetHash(dir)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alloc > largeFileSize/8 {
+		t.Errorf("MigrationSetHash allocated %d bytes for a %d byte file", alloc, largeFileSize)
+	}
+}
+
+func TestCombinedSQLAddsTrailingNewline(t *testing.T) {
+	scriptsDir := newTestProject(t, nil)
+	err := os.WriteFile(scriptsDir+"/up/001-a.sql", []byte("select 1;"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, scriptsDir+"/up", "002-b.sql")
+
+	var combined string
+	combined, err = CombinedSQL(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"-- file: 001-a.sql",
+		"select 1;",
+		"",
+		"-- file: 002-b.sql",
+		"select 1;",
+		"",
+	}, "\n")
+	if combined != want {
+		t.Errorf("CombinedSQL = %q, want %q", combined, want)
+	}
+}
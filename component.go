@@ -0,0 +1,47 @@
+package gograte
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// componentRegexp matches a component name
+var componentRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// validateComponent ensures the component name can be used in a
+// directory and table name
+func validateComponent(component string) error {
+	if component == "" || componentRegexp.MatchString(component) {
+		return nil
+	}
+	return fmt.Errorf("invalid component %q: use lowercase letters, digits and underscores, starting with a letter", component)
+}
+
+// scriptsDir returns the directory holding the up and down
+// directories: migrationScriptsDir, or its component subdirectory
+// when a component is configured, e.g. ./scripts/db/migrations/billing
+func (f ConfigFile) scriptsDir() string {
+	if f.Config.Component == "" {
+		return f.Config.MigrationScriptsDir
+	}
+	return f.Config.MigrationScriptsDir + "/" + f.Config.Component
+}
+
+// downDir returns the directory holding the down files when
+// downScriptsDir is configured, or its component subdirectory when a
+// component is configured, otherwise ""
+func (f ConfigFile) downDir() string {
+	if f.Config.DownScriptsDir == "" || f.Config.Component == "" {
+		return f.Config.DownScriptsDir
+	}
+	return f.Config.DownScriptsDir + "/" + f.Config.Component
+}
+
+// componentSuffix returns "_" followed by the component, or "" when no
+// component is configured
+func (f ConfigFile) componentSuffix() string {
+	if f.Config.Component == "" {
+		return ""
+	}
+	return "_" + f.Config.Component
+}
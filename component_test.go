@@ -0,0 +1,89 @@
+package gograte
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComponentsShareDatabase(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.Component = "billing"
+	})
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"max(batch)", "0"},
+	)
+
+	// a second profile for the auth component of the same database
+	configDir := os.Getenv("GOGRATE_CONFIG_DIR")
+	b, err := os.ReadFile(filepath.Join(configDir, testProfile+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f ConfigFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Config.Component = "auth"
+	b, err = json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(configDir, "auth.json"), b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, component := range []string{"billing", "auth"} {
+		dir := filepath.Join(scriptsDir, component, "up")
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, dir, "001-"+component+".sql")
+	}
+
+	for _, c := range []struct{ profile, component string }{
+		{testProfile, "billing"},
+		{"auth", "auth"},
+	} {
+		err = os.Remove(log)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		err = Run(true, c.profile)
+		if err != nil {
+			t.Fatalf("%s: %v", c.component, err)
+		}
+
+		table := "schema_migrations_" + c.component
+		var (
+			ran     []string
+			queries int
+		)
+		for _, call := range psqlCalls(t, log) {
+			for _, a := range call {
+				if !strings.Contains(a, "schema_migrations") {
+					continue
+				}
+				queries++
+				if !strings.Contains(a, table) {
+					t.Errorf("%s: tracker query is not scoped to %s: %s", c.component, table, a)
+				}
+			}
+			ran = append(ran, fileArgsOrder(call)...)
+		}
+		if queries == 0 {
+			t.Errorf("%s: no tracker queries were made", c.component)
+		}
+		if len(ran) != 1 || filepath.Base(ran[0]) != "001-"+c.component+".sql" {
+			t.Errorf("%s: ran %q, want only the component's file", c.component, ran)
+		}
+	}
+}
@@ -2,6 +2,29 @@ package config
 
 #Base: {
 	migrationScriptsDir: !="" // must be specified and non-empty
+	namingScheme?:       "sequence" | "timestamp" | "flyway"
+	layout?:             "subdirs" | "suffix"
+	downScriptsDir?:     !=""
+	allowEmptyDown?:     bool
+
+	allowAbsoluteScriptsDir?: bool
+	component?:               =~"^[a-z][a-z0-9_]*$"
+
+	fileNumberWidth?:       int & >0
+	strictFileNumberWidth?: bool
+
+	protected?: bool
+	destructiveStatements?: [...!=""]
+
+	excludeFiles?: [...!=""]
+	includeOnly?: [...!=""]
+
+	baselineVersion?: int & >=0
+
+	template?: {
+		enabled?: bool
+		vars?: [string]: string
+	}
 }
 
 #Database: {
@@ -9,11 +32,88 @@ package config
 	port:       !=0  // must be specified and non-empty
 	name:       !="" // must be specified and non-empty
 	user:       !="" // must be specified and non-empty
-	password:   !="" // must be specified and non-empty
+	password?:  !="" // must be non-empty unless passwordFromStdin is set
 	searchPath: !="" // must be specified and non-empty
+
+	options?: [string]: string
+	params?:  [string]: string
+
+	applicationName?:     !=""
+	maintenanceDatabase?: !=""
+
+	clientEncoding?: !=""
+
+	replica?: {
+		host?: !=""
+		port?: !=0
+	}
+
+	passwordFromStdin?:     bool
+	createSchemas?:         bool
+	verifyCurrentDatabase?: bool
+
+	requiredPrivileges?: {
+		database?: [..."CREATE" | "CONNECT" | "TEMPORARY" | "TEMP"]
+		schema?: [..."CREATE" | "USAGE"]
+	}
+}
+
+#PSQL: {
+	extraArgs?:      [...string]
+	passwordPrompt?: "never" | "always" | "auto"
+	echoQueries?:    bool
+
+	singleTransaction?:     bool
+	singleTransactionUp?:   bool
+	singleTransactionDown?: bool
+	minVersion?:            =~"^[0-9]+(\\.[0-9]+)?$"
+	includeScript?:         bool
+	connectAttempts?:       int & >0
+	clientMinMessages?:     "debug5" | "debug4" | "debug3" | "debug2" | "debug1" | "log" | "notice" | "warning" | "error"
+	isolationLevel?:        "read uncommitted" | "read committed" | "repeatable read" | "serializable"
+	slowFileThreshold?:     =~"^[0-9]"
+	fastUnsafe?:            bool // unsafe for production
+
+	output?: {
+		automation?: bool
+		quiet?:      bool
+		pagerOff?:   bool
+		terse?:      bool
+	}
+}
+
+#AdvisoryLock: {
+	enabled: bool | *false
+	key?:    int & !=0
+}
+
+#Tracking: {
+	enabled: bool | *false
+	table?:  =~"^[a-z_][a-z0-9_]*(\\.[a-z_][a-z0-9_]*)?$"
+
+	manifest?: !=""
+
+	abortIfAhead?: bool
+}
+
+#SSHTunnel: {
+	host:       !=""
+	port?:      int & >0
+	user:       !=""
+	keyPath?:   !=""
+	localPort?: int & >0
+}
+
+#Webhook: {
+	url: =~"^https?://"
 }
 
 #Config: {
 	#Base
-	database: #Database
+	database:      #Database
+	psql?:         #PSQL
+	advisoryLock?: #AdvisoryLock
+	tracking?:     #Tracking
+	sshTunnel?:    #SSHTunnel
+	webhook?:      #Webhook
 }
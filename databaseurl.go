@@ -0,0 +1,57 @@
+package gograte
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// databaseURLEnv names the environment variable holding a connection
+// URI which overrides the config file's connection settings
+const databaseURLEnv = "DATABASE_URL"
+
+// applyDatabaseURL overrides the connection fields of f with those
+// set in rawURL, a postgresql:// connection URI. The host, port,
+// database name, user and password are taken from the URI when present
+// in it; every other setting, e.g. migrationScriptsDir and searchPath,
+// still comes from the file.
+func (f *ConfigFile) applyDatabaseURL(rawURL string) error {
+	m, err := parseConnectionURI(rawURL)
+	if err != nil {
+		// the URI may hold a password, so it is not repeated
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("invalid %s: %w", databaseURLEnv, err)
+	}
+
+	db := &f.Config.Database
+	if m["host"] != "" {
+		db.Host = m["host"]
+	}
+	if m["port"] != "0" {
+		db.Port, err = strconv.Atoi(m["port"])
+		if err != nil {
+			return fmt.Errorf("invalid %s port: %w", databaseURLEnv, err)
+		}
+	}
+	if m["dbname"] != "" {
+		db.Name = m["dbname"]
+	}
+	if m["user"] != "" {
+		db.User = m["user"]
+	}
+	if p, ok := m["password"]; ok {
+		db.Password = p
+	}
+
+	return nil
+}
+
+// databaseURL returns the value of DATABASE_URL, or "" if it is unset
+func databaseURL() string {
+	return os.Getenv(databaseURLEnv)
+}
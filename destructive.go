@@ -0,0 +1,91 @@
+package gograte
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirmDestructiveEnv is the environment variable which, when set to
+// the profile name, confirms destructive statements may run against a
+// protected profile
+const confirmDestructiveEnv = "GOGRATE_CONFIRM_DESTRUCTIVE"
+
+// defaultDestructiveStatements are the statement prefixes treated as
+// destructive when none are configured
+var defaultDestructiveStatements = []string{"DROP TABLE", "DROP SCHEMA", "DROP DATABASE", "DROP COLUMN", "TRUNCATE", "DELETE FROM"}
+
+// ErrNotConfirmed is returned when destructive statements would run
+// against a protected profile without confirmation
+var ErrNotConfirmed = errors.New("destructive statements were not confirmed")
+
+// DestructiveStatement is a destructive statement found in a DDL file
+type DestructiveStatement struct {
+	Filename string
+	// Keyword is the configured keyword which matched, e.g. DROP TABLE
+	Keyword string
+	// Statement is the first line of the matching statement
+	Statement string
+}
+
+// String returns a readable description of the finding
+func (ds DestructiveStatement) String() string {
+	return fmt.Sprintf("%s: %s (%s)", ds.Filename, ds.Keyword, ds.Statement)
+}
+
+// scanDestructive returns the destructive statements found in the
+// files of the migration. A statement matches a keyword if it contains
+// it, ignoring case and differences in whitespace, so DROP COLUMN is
+// found inside ALTER TABLE statements.
+func (m migration) scanDestructive() ([]DestructiveStatement, error) {
+	keywords := m.config.Config.DestructiveStatements
+	if len(keywords) == 0 {
+		keywords = defaultDestructiveStatements
+	}
+
+	var found []DestructiveStatement
+	for _, df := range m.files {
+		b, err := readSQLFile(m.dir + "/" + df.filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range SplitStatements(string(b)) {
+			normalized := " " + strings.ToUpper(strings.Join(strings.Fields(stmt), " ")) + " "
+			for _, kw := range keywords {
+				if strings.Contains(normalized, " "+strings.ToUpper(strings.Join(strings.Fields(kw), " "))+" ") {
+					found = append(found, DestructiveStatement{Filename: df.filename, Keyword: kw, Statement: firstLine(stmt)})
+					break
+				}
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// confirmDestructive scans the migration for destructive statements
+// when the profile is protected. If any are found, they must be
+// confirmed by the confirm callback, or by setting
+// GOGRATE_CONFIRM_DESTRUCTIVE to the profile name, otherwise an
+// ErrNotConfirmed error listing every finding is returned.
+func (m migration) confirmDestructive(profile string, confirm func([]DestructiveStatement) bool) error {
+	if !m.config.Config.Protected {
+		return nil
+	}
+
+	found, err := m.scanDestructive()
+	if err != nil || len(found) == 0 {
+		return err
+	}
+
+	if os.Getenv(confirmDestructiveEnv) == profile || (confirm != nil && confirm(found)) {
+		return nil
+	}
+
+	problems := make([]string, len(found))
+	for i, ds := range found {
+		problems[i] = ds.String()
+	}
+	return fmt.Errorf("%w for protected profile %q, set %s=%s to proceed:\n\t%s", ErrNotConfirmed, profile, confirmDestructiveEnv, profile, strings.Join(problems, "\n\t"))
+}
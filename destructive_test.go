@@ -0,0 +1,65 @@
+package gograte
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRollbackBatchConfirmsDestructiveStatements(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Protected = true
+		f.Config.Tracking.Enabled = true
+	})
+	writeFiles(t, scriptsDir+"/down", "001-a.sql")
+	err := os.WriteFile(scriptsDir+"/down/002-b.sql", []byte("drop table b;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where not dirty", `1\n2`},
+		[2]string{"max(batch)", "1"},
+		[2]string{"where batch = 1", `1\n2`},
+	)
+
+	err = RollbackBatch(testProfile)
+	if !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("err = %v, want ErrNotConfirmed", err)
+	}
+	for _, call := range psqlCalls(t, log) {
+		if len(fileArgsOrder(call)) > 0 {
+			t.Fatalf("files ran without confirmation: %q", call)
+		}
+	}
+
+	t.Setenv(confirmDestructiveEnv, testProfile)
+	err = RollbackBatch(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmDestructiveOnlyScansFilesToRun(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Protected = true
+		f.Config.Tracking.Enabled = true
+	})
+	err := os.WriteFile(scriptsDir+"/up/001-a.sql", []byte("drop table old;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, scriptsDir+"/up", "002-b.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where not dirty", "1"},
+		[2]string{"max(batch)", "1"},
+	)
+
+	err = Run(true, testProfile)
+	if err != nil {
+		t.Fatalf("the applied file was scanned: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package gograte
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// DoctorCheck is the outcome of one check run by Doctor
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Message describes what was found, or what to do about a failure
+	Message string `json:"message"`
+}
+
+// DoctorReport lists the checks run by Doctor, in order
+type DoctorReport struct {
+	Profile string        `json:"profile"`
+	Checks  []DoctorCheck `json:"checks"`
+}
+
+// Passed reports whether every check passed
+func (r DoctorReport) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// String lists each check as PASS or FAIL with its message
+func (r DoctorReport) String() string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		result := "PASS"
+		if !c.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s  %s: %s\n", result, c.Name, c.Message)
+	}
+	return b.String()
+}
+
+// add appends a check which passed with msg when err is nil, otherwise
+// failed with err and hint
+func (r *DoctorReport) add(name string, err error, msg, hint string) {
+	if err == nil {
+		r.Checks = append(r.Checks, DoctorCheck{Name: name, Passed: true, Message: msg})
+		return
+	}
+	msg = err.Error()
+	if hint != "" {
+		msg += " (" + hint + ")"
+	}
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Message: msg})
+}
+
+// Doctor checks everything a migration for the given profile depends
+// on, from config to connection, and reports each check as passed or
+// failed with an actionable message:
+//
+//   - the JSON config loads and matches the schema (see ValidateConfigCUE)
+//   - the up and down directories exist and their filenames are valid
+//   - psql is installed and meets psql.minVersion
+//   - a connection to the database succeeds (see Ping)
+//
+// Checks which depend on a failed one are left out. Nothing is
+// executed against the database beyond a trivial query.
+func Doctor(profile string, opts ...Option) DoctorReport {
+	o := newOptions(opts)
+	r := DoctorReport{Profile: profile}
+
+	f, err := loadProfileIn(o.baseDir, profile)
+	r.add("config", err, "loaded "+profilePath(o.baseDir, profile), fmt.Sprintf("create it with mage -v cueGenConfig %s, or check GOGRATE_CONFIG_DIR", profile))
+	if err != nil {
+		return r
+	}
+	r.add("schema", ValidateConfigCUE(profile, opts...), "matches "+cueDir+"/"+cueSchemaFile, "fix the fields reported")
+
+	for _, up := range []bool{true, false} {
+		name := "down files"
+		if up {
+			name = "up files"
+		}
+		msg, err := checkFiles(f, up)
+		r.add(name, err, msg, "check migrationScriptsDir and that filenames follow the "+f.namingScheme()+" naming scheme")
+	}
+
+	var major, minor int
+	major, minor, err = PSQLVersion()
+	if err == nil {
+		err = checkPSQLVersion(f.Config.PSQL.MinVersion)
+	}
+	r.add("psql", err, fmt.Sprintf("version %d.%d", major, minor), "install the PostgreSQL client and make sure psql is on PATH")
+	if err != nil {
+		return r
+	}
+
+	r.add("connection", pingProfile(f), "connected to "+newPostgreSQLDSN(f).Redacted(), "check the database host, port, user and password in the config, DATABASE_URL and PGPASSWORD")
+
+	return r
+}
+
+// checkFiles reads the DDL files for the given direction, returning
+// how many were found where
+func checkFiles(f ConfigFile, up bool) (string, error) {
+	dir, cleanup, err := migrationDir(f, up)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(up))
+	if !up && f.Config.AllowEmptyDown && errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("%s does not exist, allowEmptyDown is set", dir), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d files in %s", len(ddlFiles), dir), nil
+}
+
+// pingProfile runs Ping against the database for f, through its SSH
+// tunnel if one is configured
+func pingProfile(f ConfigFile) error {
+	dsn, closeTunnel, err := tunnelDSN(f)
+	if err != nil {
+		return err
+	}
+	defer closeTunnel()
+	return Ping(dsn)
+}
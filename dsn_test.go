@@ -0,0 +1,195 @@
+package gograte
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConnectionStrings(t *testing.T) {
+	tests := []struct {
+		name         string
+		dsn          PostgreSQLDSN
+		uri          string
+		keywordValue string
+	}{
+		{
+			name:         "mixed case database",
+			dsn:          PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "My-DB", User: "migrator"},
+			uri:          "postgresql://migrator@localhost:5432/My-DB",
+			keywordValue: "host=localhost port=5432 dbname=My-DB user=migrator sslmode=disable",
+		},
+		{
+			name:         "database with a space",
+			dsn:          PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "My DB", User: "migrator", Password: "it's"},
+			uri:          "postgresql://migrator@localhost:5432/My%20DB",
+			keywordValue: `host=localhost port=5432 dbname='My DB' user=migrator password='it\'s' sslmode=disable`,
+		},
+		{
+			name:         "mixed case schema",
+			dsn:          PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator", SearchPath: "Sales, public"},
+			uri:          "postgresql://migrator@localhost:5432/app?options=-csearch_path%3D%22Sales%22%2Cpublic",
+			keywordValue: `host=localhost port=5432 dbname=app user=migrator sslmode=disable search_path="Sales",public`,
+		},
+		{
+			name: "startup options with search_path",
+			dsn: PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator", SearchPath: "public",
+				Options: map[string]string{"timezone": "UTC", "statement_timeout": "0"}},
+			uri:          "postgresql://migrator@localhost:5432/app?options=-csearch_path%3Dpublic+-cstatement_timeout%3D0+-ctimezone%3DUTC",
+			keywordValue: "host=localhost port=5432 dbname=app user=migrator sslmode=disable options='-cstatement_timeout=0 -ctimezone=UTC' search_path=public",
+		},
+		{
+			name: "startup option with a space",
+			dsn: PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator",
+				Options: map[string]string{"application_name": "a b"}},
+			uri:          "postgresql://migrator@localhost:5432/app?options=-capplication_name%3Da%5C+b",
+			keywordValue: `host=localhost port=5432 dbname=app user=migrator sslmode=disable options='-capplication_name=a\\ b'`,
+		},
+		{
+			name: "client encoding",
+			dsn: PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator", SearchPath: "public",
+				ClientEncoding: "LATIN1"},
+			uri:          "postgresql://migrator@localhost:5432/app?client_encoding=LATIN1&options=-csearch_path%3Dpublic",
+			keywordValue: "host=localhost port=5432 dbname=app user=migrator sslmode=disable client_encoding=LATIN1 search_path=public",
+		},
+		{
+			name: "params with search_path",
+			dsn: PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator", SearchPath: "public",
+				Params: map[string]string{"target_session_attrs": "read-write", "keepalives": "1", "sslrootcert": "/etc/my certs/ca.pem"}},
+			uri:          "postgresql://migrator@localhost:5432/app?keepalives=1&options=-csearch_path%3Dpublic&sslrootcert=%2Fetc%2Fmy+certs%2Fca.pem&target_session_attrs=read-write",
+			keywordValue: "host=localhost port=5432 dbname=app user=migrator sslmode=disable keepalives=1 sslrootcert='/etc/my certs/ca.pem' target_session_attrs=read-write search_path=public",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dsn.ConnectionURI(); got != tt.uri {
+				t.Errorf("ConnectionURI() = %s, want %s", got, tt.uri)
+			}
+			if got := tt.dsn.KeywordValueConnectionString(); got != tt.keywordValue {
+				t.Errorf("KeywordValueConnectionString() = %s, want %s", got, tt.keywordValue)
+			}
+		})
+	}
+}
+
+func TestMixedCaseDatabaseReachesPSQL(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Database.Name = "My-DB"
+		f.Config.Database.SearchPath = "Sales"
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+	t.Setenv("FAKEPSQL_DB", "My-DB")
+
+	err := Run(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := psqlCalls(t, log)
+	want := "postgresql://migrator@localhost:5432/My-DB?options=-csearch_path%3D%22Sales%22"
+	if i := indexOf(calls[len(calls)-1], "-d", want); i == -1 {
+		t.Fatalf("psql was not connected to %s: %q", want, calls[len(calls)-1])
+	}
+}
+
+func TestClientEncodingUnsetByDefault(t *testing.T) {
+	dsn := PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator"}
+	for _, s := range []string{dsn.ConnectionURI(), dsn.KeywordValueConnectionString()} {
+		if strings.Contains(s, "client_encoding") {
+			t.Errorf("client_encoding set without being configured: %s", s)
+		}
+	}
+
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.Database.ClientEncoding = "UTF8"
+	})
+	var err error
+	dsn, err = BuildDSN(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn.ClientEncoding != "UTF8" {
+		t.Errorf("ClientEncoding = %q, want the configured UTF8", dsn.ClientEncoding)
+	}
+}
+
+func TestConfigParams(t *testing.T) {
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.Database.Params = map[string]string{"target_session_attrs": "read-write", "keepalives": "1"}
+	})
+	dsn, err := BuildDSN(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(dsn.ConnectionURI(), "?keepalives=1&options=-csearch_path%3Dpublic&target_session_attrs=read-write") {
+		t.Errorf("params missing from %s", dsn.ConnectionURI())
+	}
+
+	for _, params := range []map[string]string{
+		{"bad name": "1"},
+		{"options": "-ctimezone=UTC"},
+	} {
+		newTestProject(t, func(f *ConfigFile) {
+			f.Config.Database.Params = params
+		})
+		_, err = BuildDSN(testProfile)
+		if err == nil {
+			t.Errorf("params %v accepted", params)
+		}
+	}
+}
+
+func TestEnvExports(t *testing.T) {
+	dsn := PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator", Password: "secret", SearchPath: "public"}
+	want := []string{
+		"PGHOST=localhost",
+		"PGPORT=5432",
+		"PGDATABASE=app",
+		"PGUSER=migrator",
+		"PGPASSWORD=secret",
+		"PGOPTIONS=-csearch_path=public",
+	}
+	got := dsn.EnvExports()
+	if !slices.Equal(got, want) {
+		t.Errorf("EnvExports() = %q, want %q", got, want)
+	}
+}
+
+func TestEnvExportsOmitsUnset(t *testing.T) {
+	dsn := PostgreSQLDSN{Host: "localhost", DBName: "app"}
+	want := []string{"PGHOST=localhost", "PGDATABASE=app"}
+	got := dsn.EnvExports()
+	if !slices.Equal(got, want) {
+		t.Errorf("EnvExports() = %q, want %q", got, want)
+	}
+}
+
+func TestEnvExportsEval(t *testing.T) {
+	dsn := PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "My DB", User: "migrator",
+		Password: `it's $HOME "quoted"`, SearchPath: "Sales, public"}
+	script := "export " + strings.Join(dsn.EnvExports(), "\nexport ")
+	script += "\nprintf '%s\\n' \"$PGDATABASE\" \"$PGPASSWORD\" \"$PGOPTIONS\""
+
+	out, err := exec.Command("sh", "-c", script).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "My DB\n" + dsn.Password + "\n" + dsn.startupOptions(true) + "\n"
+	if string(out) != want {
+		t.Errorf("evaluated exports = %q, want %q", out, want)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	dsn := PostgreSQLDSN{Host: "localhost", Port: 5432, DBName: "app", User: "migrator", Password: "secret", Params: map[string]string{"sslpassword": "keypass"}}
+	got := dsn.Redacted()
+	want := "host=localhost port=5432 dbname=app user=migrator password=*** sslmode=disable sslpassword=***"
+	if got != want {
+		t.Errorf("Redacted() = %q, want %q", got, want)
+	}
+	if dsn.Params["sslpassword"] != "keypass" {
+		t.Errorf("Redacted changed the DSN's params")
+	}
+}
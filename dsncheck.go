@@ -0,0 +1,169 @@
+package gograte
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AssertDSNConsistent renders dsn with both ConnectionURI and
+// KeywordValueConnectionString, parses each rendering back and
+// confirms they describe the same connection: host, port, database,
+// user, client_encoding, params, search_path and startup options.
+// Every difference is reported in the returned error.
+//
+// ConnectionURI never includes the password, which is passed to psql
+// in PGPASSWORD, so the password is only compared when the URI carries
+// one. The keyword/value form must always carry a non-empty password.
+func AssertDSNConsistent(dsn PostgreSQLDSN) error {
+	uri, err := parseConnectionURI(dsn.ConnectionURI())
+	if err != nil {
+		return fmt.Errorf("parse connection URI: %w", err)
+	}
+	var kv map[string]string
+	kv, err = parseKeywordValue(dsn.KeywordValueConnectionString())
+	if err != nil {
+		return fmt.Errorf("parse keyword/value connection string: %w", err)
+	}
+	kvOpts := parseStartupOptions(kv["options"])
+	if sp, ok := kv["search_path"]; ok {
+		kvOpts["search_path"] = sp
+	}
+
+	var problems []string
+	compare := func(name, u, k string) {
+		if u != k {
+			problems = append(problems, fmt.Sprintf("%s: URI has %q, keyword/value has %q", name, u, k))
+		}
+	}
+
+	compare("host", uri["host"], kv["host"])
+	compare("port", uri["port"], kv["port"])
+	compare("dbname", uri["dbname"], kv["dbname"])
+	compare("user", uri["user"], kv["user"])
+	compare("client_encoding", uri["client_encoding"], kv["client_encoding"])
+	for _, k := range sortedKeys(dsn.Params) {
+		compare(k, uri[k], kv[k])
+	}
+	if p, ok := uri["password"]; ok {
+		compare("password", p, kv["password"])
+	}
+	if dsn.Password != "" && kv["password"] != dsn.Password {
+		problems = append(problems, "password: keyword/value does not carry the configured password")
+	}
+
+	uriOpts := parseStartupOptions(uri["options"])
+	for k, v := range uriOpts {
+		compare("option "+k, v, kvOpts[k])
+	}
+	for k, v := range kvOpts {
+		if _, ok := uriOpts[k]; !ok {
+			compare("option "+k, "", v)
+		}
+	}
+
+	return problemsError("connection URI and keyword/value connection string differ", problems)
+}
+
+// parseConnectionURI parses a postgresql:// URI into keyword/value
+// pairs. A missing port is reported as "0", matching the keyword/value
+// rendering of an unset port.
+func parseConnectionURI(s string) (map[string]string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "postgresql" && u.Scheme != "postgres" {
+		return nil, fmt.Errorf("unexpected scheme %q", u.Scheme)
+	}
+
+	m := map[string]string{
+		"host":   u.Hostname(),
+		"port":   u.Port(),
+		"dbname": strings.TrimPrefix(u.Path, "/"),
+	}
+	if m["port"] == "" {
+		m["port"] = "0"
+	}
+	if u.User != nil {
+		m["user"] = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			m["password"] = p
+		}
+	}
+	for k, v := range u.Query() {
+		m[k] = v[0]
+	}
+	return m, nil
+}
+
+// parseKeywordValue parses a libpq keyword/value connection string.
+// Values may be single quoted, with \' and \\ escapes.
+func parseKeywordValue(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for i := 0; i < len(s); {
+		if s[i] == ' ' {
+			i++
+			continue
+		}
+		eq := strings.IndexByte(s[i:], '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("missing = after %q", s[i:])
+		}
+		key := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+
+		var v strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				v.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated quoted value for %s", key)
+			}
+			i++
+		} else {
+			for ; i < len(s) && s[i] != ' '; i++ {
+				v.WriteByte(s[i])
+			}
+		}
+		m[key] = v.String()
+	}
+	return m, nil
+}
+
+// parseStartupOptions parses the value of the options connection
+// parameter, a list of -cname=value flags with backslash escaped
+// spaces, into a map of run-time parameters
+func parseStartupOptions(s string) map[string]string {
+	opts := make(map[string]string)
+	var (
+		words []string
+		cur   strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case s[i] == ' ':
+			words = append(words, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	words = append(words, cur.String())
+
+	for _, w := range words {
+		w = strings.TrimPrefix(w, "-c")
+		if k, v, ok := strings.Cut(w, "="); ok {
+			opts[k] = v
+		}
+	}
+	return opts
+}
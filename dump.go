@@ -0,0 +1,56 @@
+package gograte
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DumpSchema runs pg_dump --schema-only against the database for the
+// given profile and writes the schema to outPath, e.g. after migrating
+// so CI can diff it against a committed reference. Like psql, pg_dump
+// must be installed and on PATH, and the password is passed to it in
+// PGPASSWORD. outPath is removed if pg_dump fails, so a partial dump
+// is never left behind.
+func DumpSchema(profile, outPath string, opts ...Option) error {
+	return dumpSchema(profile, outPath, nil, opts...)
+}
+
+// dumpSchema is DumpSchema with extra pg_dump args
+func dumpSchema(profile, outPath string, extraArgs []string, opts ...Option) error {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = exec.LookPath("pg_dump")
+	if err != nil {
+		return fmt.Errorf("pg_dump is required to dump the schema, install the PostgreSQL client and make sure pg_dump is on PATH: %w", err)
+	}
+
+	var (
+		dsn         PostgreSQLDSN
+		closeTunnel func()
+	)
+	dsn, closeTunnel, err = tunnelDSN(f)
+	if err != nil {
+		return err
+	}
+	defer closeTunnel()
+
+	var stderr bytes.Buffer
+	args := append([]string{"--schema-only", "--no-password", "--file", outPath, "--dbname", dsn.ConnectionURI()}, extraArgs...)
+	cmd := pgCommand(context.Background(), "pg_dump", dsn, args)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		_ = os.Remove(outPath)
+		return fmt.Errorf("pg_dump: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package gograte
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+)
+
+// byte order marks files authored on Windows often start with
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// readSQLFile reads the DDL file at path as text. A leading
+// UTF-8 byte order mark is removed and files with a UTF-16 byte order
+// mark are converted to UTF-8, so the content does not fail with
+// "syntax error at or near" when it is parsed or combined.
+func readSQLFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err = decodeSQL(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// sqlFileReader reads a DDL file opened by openSQLFile
+type sqlFileReader struct {
+	io.Reader
+	file *os.File
+}
+
+// Close closes the underlying file
+func (r sqlFileReader) Close() error {
+	return r.file.Close()
+}
+
+// openSQLFile opens the DDL file at path for streaming, decoding it
+// the same way as readSQLFile. Only a small buffer of the file is held
+// in memory, so files of hundreds of MB (e.g. bulk data loads) can be
+// read without loading them whole. UTF-16 files, which psql cannot run
+// anyway, are the exception and are decoded in memory.
+func openSQLFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(file)
+	// Peek returns fewer bytes, with an error, for short files
+	bom, _ := br.Peek(len(utf8BOM))
+	switch {
+	case bytes.HasPrefix(bom, utf8BOM):
+		_, err = br.Discard(len(utf8BOM))
+	case bytes.HasPrefix(bom, utf16LEBOM) || bytes.HasPrefix(bom, utf16BEBOM):
+		var b []byte
+		b, err = io.ReadAll(br)
+		if err == nil {
+			b, err = decodeSQL(b)
+		}
+		if err == nil {
+			return sqlFileReader{Reader: bytes.NewReader(b), file: file}, nil
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return sqlFileReader{Reader: br, file: file}, nil
+}
+
+// decodeSQL converts b to UTF-8 without a byte order mark, detecting
+// the encoding from its byte order mark. Content without one is
+// returned as is, it is expected to be UTF-8 or to match the
+// connection's client_encoding.
+func decodeSQL(b []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(b, utf8BOM):
+		b = b[len(utf8BOM):]
+	case bytes.HasPrefix(b, utf16LEBOM):
+		return decodeUTF16(b[len(utf16LEBOM):], false)
+	case bytes.HasPrefix(b, utf16BEBOM):
+		return decodeUTF16(b[len(utf16BEBOM):], true)
+	}
+	return b, nil
+}
+
+// decodeUTF16 converts UTF-16 content, without its byte order mark,
+// to UTF-8
+func decodeUTF16(b []byte, bigEndian bool) ([]byte, error) {
+	if len(b)%2 != 0 {
+		return nil, fmt.Errorf("UTF-16 content has an odd number of bytes")
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if bigEndian {
+			u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(u))), nil
+}
+
+// encodingWarning returns a warning for a file psql -f would
+// mishandle because of a byte order mark, or "" if there is none
+func encodingWarning(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// only the byte order mark is needed
+	b := make([]byte, len(utf8BOM))
+	var n int
+	n, err = io.ReadFull(file, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	b = b[:n]
+	switch {
+	case bytes.HasPrefix(b, utf8BOM):
+		return fmt.Sprintf("%s starts with a UTF-8 byte order mark, which psql may reject, save it as UTF-8 without BOM", path), nil
+	case bytes.HasPrefix(b, utf16LEBOM) || bytes.HasPrefix(b, utf16BEBOM):
+		return fmt.Sprintf("%s is UTF-16 encoded, which psql cannot run, save it as UTF-8", path), nil
+	}
+	return "", nil
+}
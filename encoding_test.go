@@ -0,0 +1,88 @@
+package gograte
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{name: "UTF-8", in: []byte("select 'é';\n"), want: "select 'é';\n"},
+		{name: "UTF-8 with BOM", in: append([]byte{0xEF, 0xBB, 0xBF}, "select 'é';\n"...), want: "select 'é';\n"},
+		{name: "UTF-16 LE", in: []byte{0xFF, 0xFE, 's', 0, 'e', 0, 'l', 0, ';', 0, 0xE9, 0}, want: "sel;é"},
+		{name: "UTF-16 BE", in: []byte{0xFE, 0xFF, 0, 's', 0, 'e', 0, 'l', 0, ';', 0, 0xE9}, want: "sel;é"},
+		{name: "empty", in: nil, want: ""},
+	}
+	for _, tt := range tests {
+		got, err := decodeSQL(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	_, err := decodeSQL([]byte{0xFF, 0xFE, 's'})
+	if err == nil {
+		t.Error("odd length UTF-16 accepted")
+	}
+}
+
+func TestBOMPrefixedFile(t *testing.T) {
+	scriptsDir := newTestProject(t, nil)
+	path := filepath.Join(scriptsDir, "up", "001-a.sql")
+	err := os.WriteFile(path, append([]byte{0xEF, 0xBB, 0xBF}, "create table a (id int);\n"...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := readSQLFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "create table a (id int);\n" {
+		t.Errorf("readSQLFile = %q, want the BOM removed", b)
+	}
+
+	r, err := openSQLFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "create table a (id int);\n" {
+		t.Errorf("openSQLFile read %q, want the BOM removed", b)
+	}
+
+	var combined string
+	combined, err = CombinedSQL(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains([]byte(combined), []byte{0xEF, 0xBB, 0xBF}) || !strings.Contains(combined, "create table a (id int);") {
+		t.Errorf("CombinedSQL = %q, want the file without its BOM", combined)
+	}
+
+	writeFiles(t, filepath.Join(scriptsDir, "down"), "001-a.sql")
+	var warnings []string
+	warnings, err = Verify(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "byte order mark") {
+		t.Errorf("Verify warnings = %q, want the BOM reported", warnings)
+	}
+}
@@ -0,0 +1,53 @@
+package gograte
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// confirmExecEnv names the environment variable which must be set to
+// the profile name to run Exec against a protected profile
+const confirmExecEnv = "GOGRATE_CONFIRM_EXEC"
+
+// Exec runs sql, a single psql -c command, against the connection for
+// the given profile and returns psql's combined stdout and stderr. It
+// is meant for quick checks, e.g. inspecting state between migration
+// steps. The output is returned along with any error so psql's message
+// is not lost.
+//
+// A protected profile is refused with ErrNotConfirmed unless the
+// GOGRATE_CONFIRM_EXEC environment variable is set to the profile name.
+func Exec(profile, sql string, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return nil, err
+	}
+	if f.Config.Protected && os.Getenv(confirmExecEnv) != profile {
+		return nil, fmt.Errorf("%w: profile %q is protected, set %s=%s to run ad hoc SQL against it", ErrNotConfirmed, profile, confirmExecEnv, profile)
+	}
+
+	err = validatePasswordPrompt(f.Config.PSQL.PasswordPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dsn         PostgreSQLDSN
+		closeTunnel func()
+	)
+	dsn, closeTunnel, err = tunnelDSN(f)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTunnel()
+
+	args := append(f.passwordArgs(), "-X", "-v", "ON_ERROR_STOP=1", "-d", dsn.ConnectionURI(), "-c", sql)
+	var out []byte
+	out, err = psqlCommand(context.Background(), dsn, args).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("psql: %w", newPSQLError(err, string(out)))
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package gograte
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// matchesEntry reports whether df is named by entry, either by file
+// number (e.g. 7 or, for Flyway, 1.2) or by filename
+func (df ddlFile) matchesEntry(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	if entry == df.filename {
+		return true
+	}
+	// leading zeros are optional when matching by number
+	return strings.TrimLeft(entry, "0") == strings.TrimLeft(df.versionKey(), "0")
+}
+
+// filterFileList applies the excludeFiles and includeOnly config lists
+// to ddlFiles read from dir. Every entry must name a file in dir, so a
+// typo is reported rather than silently running an excluded file.
+func filterFileList(ddlFiles []ddlFile, dir string, exclude, includeOnly []string) ([]ddlFile, error) {
+	var problems []string
+	for _, list := range []struct {
+		name    string
+		entries []string
+	}{{"excludeFiles", exclude}, {"includeOnly", includeOnly}} {
+		for _, entry := range list.entries {
+			found := false
+			for _, df := range ddlFiles {
+				if df.matchesEntry(entry) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s entry %q matches no file in %s", list.name, entry, dir))
+			}
+		}
+	}
+	err := problemsError("invalid file list", problems)
+	if err != nil {
+		return nil, err
+	}
+
+	matchesAny := func(df ddlFile, entries []string) bool {
+		for _, entry := range entries {
+			if df.matchesEntry(entry) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var filtered []ddlFile
+	for _, df := range ddlFiles {
+		if matchesAny(df, exclude) {
+			continue
+		}
+		if len(includeOnly) > 0 && !matchesAny(df, includeOnly) {
+			continue
+		}
+		filtered = append(filtered, df)
+	}
+
+	return filtered, nil
+}
+
+// filterGlob returns the files whose name matches pattern
+func filterGlob(ddlFiles []ddlFile, pattern string) ([]ddlFile, error) {
+	// Match only reports a bad pattern when it gets that far in the
+	// name, so the pattern is checked on its own first
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+
+	var matched []ddlFile
+	for _, df := range ddlFiles {
+		var ok bool
+		ok, err = path.Match(pattern, df.filename)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+		if ok {
+			matched = append(matched, df)
+		}
+	}
+	return matched, nil
+}
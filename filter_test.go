@@ -0,0 +1,105 @@
+package gograte
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterFileList(t *testing.T) {
+	var ddlFiles []ddlFile
+	for _, name := range []string{"001-a.sql", "002-tenant_x.sql", "003-c.sql", "004-d.sql"} {
+		df, err := newDDLFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ddlFiles = append(ddlFiles, df)
+	}
+
+	tests := []struct {
+		name        string
+		exclude     []string
+		includeOnly []string
+		want        []string
+	}{
+		{name: "exclude by number", exclude: []string{"2"}, want: []string{"001-a.sql", "003-c.sql", "004-d.sql"}},
+		{name: "exclude by padded number", exclude: []string{"002"}, want: []string{"001-a.sql", "003-c.sql", "004-d.sql"}},
+		{name: "exclude by name", exclude: []string{"002-tenant_x.sql", "4"}, want: []string{"001-a.sql", "003-c.sql"}},
+		{name: "include only", includeOnly: []string{"1", "003-c.sql"}, want: []string{"001-a.sql", "003-c.sql"}},
+		{name: "exclude wins", exclude: []string{"1"}, includeOnly: []string{"1", "3"}, want: []string{"003-c.sql"}},
+	}
+	for _, tt := range tests {
+		filtered, err := filterFileList(ddlFiles, "up", tt.exclude, tt.includeOnly)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, df := range filtered {
+			got = append(got, df.filename)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	_, err := filterFileList(ddlFiles, "up", []string{"5"}, []string{"003-typo.sql"})
+	if err == nil || !strings.Contains(err.Error(), `excludeFiles entry "5"`) || !strings.Contains(err.Error(), `includeOnly entry "003-typo.sql"`) {
+		t.Errorf("err = %v, want both unknown entries reported", err)
+	}
+}
+
+func TestConfigExcludeFiles(t *testing.T) {
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.ExcludeFiles = []string{"002-tenant_x.sql"}
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-tenant_x.sql", "003-c.sql")
+
+	args, err := PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fileArgsOrder(args), []string{"001-a.sql", "003-c.sql"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files %q, want %q", got, want)
+	}
+}
+
+func TestArgsGlob(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/up",
+		"001-create-users.sql", "002-online-index.sql", "003-backfill.sql",
+		"010-online-constraint.sql", "004-online-column.sql")
+
+	args, err := PSQLArgs(true, testProfile, WithGlob("*-online-*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"002-online-index.sql", "004-online-column.sql", "010-online-constraint.sql"}
+	if got := fileArgsOrder(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
+
+func TestArgsGlobErrors(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{pattern: "[", wantErr: `invalid glob "["`},
+		{pattern: "*.sql[", wantErr: `invalid glob "*.sql["`},
+		{pattern: "*-online-*.sql", wantErr: `match "*-online-*.sql"`},
+		// the pattern is matched against the file name only
+		{pattern: "up/*.sql", wantErr: `match "up/*.sql"`},
+	}
+	for _, tt := range tests {
+		_, err := PSQLArgs(true, testProfile, WithGlob(tt.pattern))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("WithGlob(%q) error = %v, want %q", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
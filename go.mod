@@ -1,5 +1,8 @@
 module github.com/gilcrest/gograte
 
-go 1.19
+go 1.20
 
-require github.com/magefile/mage v1.13.0
+require (
+	cuelang.org/go v0.6.0
+	github.com/magefile/mage v1.13.0
+)
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,20 +19,93 @@ import (
 type ddlFile struct {
 	filename   string
 	fileNumber int
+	// version holds the numeric components of the file's version,
+	// a single element unless a dotted Flyway version is used
+	version []int
+	headers fileHeaders
+	// checksum is the SHA-256 of the file, set for up files which
+	// are recorded in the tracking table
+	checksum string
 }
 
+// maxFileNumberDigits is the most digits a file number may have,
+// enough for a TimestampNaming prefix such as 20240115093000
+const maxFileNumberDigits = len(timestampLayout)
+
 // newDDLFile initializes a DDLFile struct. File naming convention
 // should be 001-user.sql where 001 represents the file number order
-// to be processed
+// to be processed. The file number must be a positive whole number of
+// at most maxFileNumberDigits digits, signs are not accepted.
 func newDDLFile(f string) (ddlFile, error) {
 	i := strings.Index(f, "-")
+	if i == -1 {
+		return ddlFile{}, fmt.Errorf("%s does not have a file number prefix followed by a dash", f)
+	}
 	fileNumber := f[:i]
+	switch {
+	case fileNumber == "":
+		// e.g. -1-foo.sql
+		return ddlFile{}, fmt.Errorf("%s does not start with a file number, negative numbers are not allowed", f)
+	case strings.Trim(fileNumber, "0123456789") != "":
+		return ddlFile{}, fmt.Errorf("%s has a file number %q which is not a whole number", f, fileNumber)
+	case len(strings.TrimLeft(fileNumber, "0")) > maxFileNumberDigits:
+		return ddlFile{}, fmt.Errorf("%s has a file number %q longer than %d digits", f, fileNumber, maxFileNumberDigits)
+	}
 	fn, err := strconv.Atoi(fileNumber)
 	if err != nil {
 		return ddlFile{}, err
 	}
+	if fn <= 0 {
+		return ddlFile{}, fmt.Errorf("%s has file number %d, file numbers start at 1", f, fn)
+	}
+
+	return ddlFile{filename: f, fileNumber: fn, version: []int{fn}}, nil
+}
+
+// filenameFormat describes the file naming convention in errors
+const filenameFormat = "<number>-<name>.sql, e.g. 001-create_user.sql"
+
+// ValidateFilename checks that name follows the file naming convention
+// of the sequence and timestamp naming schemes: a numeric prefix, a
+// dash, a non-empty name and a .sql extension. The returned error
+// describes what is wrong along with the expected format. It lets
+// editor integrations and pre-commit hooks enforce naming before
+// files are committed.
+func ValidateFilename(name string) error {
+	i := strings.Index(name, "-")
+	switch {
+	case i == -1:
+		return fmt.Errorf("%s: missing dash after the file number, expected %s", name, filenameFormat)
+	case i == 0:
+		return fmt.Errorf("%s: missing file number, expected %s", name, filenameFormat)
+	case strings.Trim(name[:i], "0123456789") != "":
+		return fmt.Errorf("%s: file number %q is not numeric, expected %s", name, name[:i], filenameFormat)
+	case !strings.HasSuffix(name, ".sql"):
+		return fmt.Errorf("%s: missing .sql extension, expected %s", name, filenameFormat)
+	case len(name[i+1:]) == len(".sql"):
+		return fmt.Errorf("%s: missing name after the file number, expected %s", name, filenameFormat)
+	}
+
+	_, err := newDDLFile(name)
+	if err != nil {
+		return fmt.Errorf("%w, expected %s", err, filenameFormat)
+	}
+	return nil
+}
+
+// parseDDLFile initializes a ddlFile from a file name using the given
+// naming scheme
+func parseDDLFile(name, namingScheme string) (ddlFile, error) {
+	if namingScheme == FlywayNaming {
+		return newFlywayDDLFile(name)
+	}
+	return newDDLFile(name)
+}
 
-	return ddlFile{filename: f, fileNumber: fn}, nil
+// prefixWidth returns the number of characters in the file number
+// prefix, including any zero padding
+func (df ddlFile) prefixWidth() int {
+	return strings.Index(df.filename, "-")
 }
 
 func (df ddlFile) String() string {
@@ -38,8 +113,13 @@ func (df ddlFile) String() string {
 }
 
 // readDDLFiles reads and returns sorted DDL files from the
-// up or down directory
-func readDDLFiles(dir string) (ddlFiles []ddlFile, err error) {
+// up or down directory, including any header comments of each file.
+// File names are parsed according to namingScheme.
+//
+// For the suffix layout, suffix is .up.sql or .down.sql and only
+// files with it are returned, files for the other direction are
+// skipped. It is "" for the subdirs layout.
+func readDDLFiles(dir, namingScheme, suffix string) (ddlFiles []ddlFile, err error) {
 
 	var files []os.DirEntry
 	files, err = os.ReadDir(dir)
@@ -51,8 +131,22 @@ func readDDLFiles(dir string) (ddlFiles []ddlFile, err error) {
 		if file.IsDir() {
 			continue
 		}
+		if suffix != "" {
+			var skip bool
+			skip, err = otherDirection(file.Name(), suffix)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", dir, err)
+			}
+			if skip {
+				continue
+			}
+		}
 		var df ddlFile
-		df, err = newDDLFile(file.Name())
+		df, err = parseDDLFile(file.Name(), namingScheme)
+		if err != nil {
+			return nil, err
+		}
+		df.headers, err = readHeaders(dir + "/" + df.filename)
 		if err != nil {
 			return nil, err
 		}
@@ -74,76 +168,386 @@ func (bfn byFileNumber) Len() int { return len(bfn) }
 // Swap sets up the elements to be swapped for the ByFileNumber slice for sorting
 func (bfn byFileNumber) Swap(i, j int) { bfn[i], bfn[j] = bfn[j], bfn[i] }
 
-// Less is the sorting logic for the ByFileNumber slice
-func (bfn byFileNumber) Less(i, j int) bool { return bfn[i].fileNumber < bfn[j].fileNumber }
+// Less is the sorting logic for the ByFileNumber slice. Versions are
+// compared component by component, so dotted Flyway versions sort
+// correctly (1.2 < 1.10). Files with equal versions are ordered by
+// filename, so the order is always deterministic.
+func (bfn byFileNumber) Less(i, j int) bool {
+	if c := compareVersions(bfn[i].version, bfn[j].version); c != 0 {
+		return c < 0
+	}
+	return bfn[i].filename < bfn[j].filename
+}
 
 // PSQLArgs takes a slice of DDL files to be executed and builds a
 // sequence of command line arguments using the appropriate flags
 // psql needs to execute files. The arguments returned for psql are as follows:
 //
 // -w flag is set to never prompt for a password as we are running this as a script
+// (see the psql passwordPrompt config for interactive use)
 //
 // -d flag sets the database connection using a Connection URI string.
 //
 // -f flag is sent before each file to tell it to process the file
-func PSQLArgs(up bool, profile string) ([]string, error) {
+//
+// opts may be given to further restrict which files are run.
+//
+// When template is enabled in the config, the -f flags name the
+// unrendered files, use Run to execute rendered ones. Likewise, files
+// extracted from an archive are removed before PSQLArgs returns.
+//
+// A profile with sshTunnel set is refused: the tunnel would be closed
+// before the args are used, so -d could not connect. Use Run, which
+// runs psql through the tunnel.
+func PSQLArgs(up bool, profile string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return nil, err
+	}
+	if f.Config.SSHTunnel.Host != "" && o.localPort == 0 {
+		return nil, fmt.Errorf("profile %q connects through sshTunnel, which PSQLArgs cannot keep open for the returned args, use Run", profile)
+	}
 
-	var (
-		f   ConfigFile
-		err error
-	)
+	var m migration
+	m, err = newMigration(up, profile, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close()
 
-	// regular config path - relative to project root
-	configFilePath := "./config/" + profile + ".json"
+	return m.args(), nil
+}
+
+const (
+	// PasswordPromptNever passes -w so psql never prompts for a
+	// password, as migrations usually run as a script (default)
+	PasswordPromptNever = "never"
+	// PasswordPromptAlways passes -W so psql always prompts for a
+	// password before connecting
+	PasswordPromptAlways = "always"
+	// PasswordPromptAuto passes neither flag, so psql prompts only
+	// if the server asks for a password which is not otherwise known
+	PasswordPromptAuto = "auto"
+)
+
+// validatePasswordPrompt ensures the configured password prompt mode is known
+func validatePasswordPrompt(mode string) error {
+	switch mode {
+	case "", PasswordPromptNever, PasswordPromptAlways, PasswordPromptAuto:
+		return nil
+	}
+	return fmt.Errorf("invalid psql passwordPrompt %q: must be %s, %s or %s", mode, PasswordPromptNever, PasswordPromptAlways, PasswordPromptAuto)
+}
+
+// passwordArgs returns the psql password prompt flag for the
+// configured passwordPrompt mode
+func (f ConfigFile) passwordArgs() []string {
+	switch f.Config.PSQL.PasswordPrompt {
+	case PasswordPromptAlways:
+		return []string{"-W"}
+	case PasswordPromptAuto:
+		return nil
+	default:
+		return []string{"-w"}
+	}
+}
+
+// managedFlags are the psql flags PSQLArgs sets itself, which may not
+// be given as extra args
+var managedFlags = []string{"-d", "--dbname", "-f", "--file", "-w", "--no-password", "-W", "--password"}
 
-	// read JSON config file
-	f, err = NewConfigFile(configFilePath)
+// validateExtraArgs ensures extra psql args do not conflict with the
+// flags PSQLArgs manages
+func validateExtraArgs(extraArgs []string) error {
+	for _, arg := range extraArgs {
+		for _, flag := range managedFlags {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") || (len(flag) == 2 && strings.HasPrefix(arg, flag) && !strings.HasPrefix(arg, "--")) {
+				return fmt.Errorf("extra psql arg %q conflicts with %s, which gograte manages", arg, flag)
+			}
+		}
+	}
+	return nil
+}
+
+// defaultConfigDir is the directory holding JSON config files,
+// relative to the project root
+const defaultConfigDir = "./config"
+
+// ConfigDir returns the directory JSON config files are read from
+// and generated into. It defaults to ./config and can be overridden
+// with the GOGRATE_CONFIG_DIR environment variable, e.g. to keep
+// CUE generated config in a gitignored build directory.
+func ConfigDir() string {
+	if dir := os.Getenv("GOGRATE_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	return defaultConfigDir
+}
+
+// verifyCurrentDatabase confirms the database the server reports via
+// current_database() matches the configured database name. This guards
+// against hosts or poolers which route the connection elsewhere.
+func verifyCurrentDatabase(dsn PostgreSQLDSN) error {
+	rows, err := queryPSQL(dsn, "select current_database()")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(rows) != 1 || rows[0][0] != dsn.DBName {
+		var got string
+		if len(rows) > 0 {
+			got = rows[0][0]
+		}
+		return fmt.Errorf("connected to database %q, expected %q: aborting before running any DDL", got, dsn.DBName)
 	}
+	return nil
+}
 
-	// determine directory from config file
-	dir := f.Config.MigrationScriptsDir
-	if up {
-		dir += "/up"
-	} else {
-		dir += "/down"
+// loadProfile reads the JSON config file for the given profile
+// from ConfigDir and validates the migration scripts directory.
+//
+// Connection settings are resolved in order of precedence:
+//
+//  1. the password read from stdin, if passwordFromStdin is set
+//  2. host, port, database, user and password in the DATABASE_URL
+//     environment variable, if it is set
+//  3. the config file
+func loadProfile(profile string) (ConfigFile, error) {
+	return loadProfileIn("", profile)
+}
+
+// loadProfileIn is loadProfile for a project rooted at baseDir, see
+// WithBaseDir. The config file and the relative paths in it are
+// resolved within baseDir when it is set.
+func loadProfileIn(baseDir, profile string) (ConfigFile, error) {
+	err := validateBaseDir(baseDir)
+	if err != nil {
+		return ConfigFile{}, err
 	}
 
-	// readDDLFiles reads and returns sorted DDL files from the up or down directory
-	var ddlFiles []ddlFile
-	ddlFiles, err = readDDLFiles(dir)
+	var f ConfigFile
+	f, err = NewConfigFile(profilePath(baseDir, profile))
 	if err != nil {
-		return nil, err
+		return ConfigFile{}, err
+	}
+
+	err = validateScriptsDir(f)
+	if err != nil {
+		return ConfigFile{}, err
+	}
+	f.resolvePaths(baseDir)
+
+	err = validateParams(f.Config.Database.Params)
+	if err != nil {
+		return ConfigFile{}, err
+	}
+
+	err = validateComponent(f.Config.Component)
+	if err != nil {
+		return ConfigFile{}, err
+	}
+
+	err = validateClientMinMessages(f.Config.PSQL.ClientMinMessages)
+	if err != nil {
+		return ConfigFile{}, err
+	}
+
+	err = validateIsolationLevel(f.Config.PSQL.IsolationLevel)
+	if err != nil {
+		return ConfigFile{}, err
+	}
+
+	if u := databaseURL(); u != "" {
+		err = f.applyDatabaseURL(u)
+		if err != nil {
+			return ConfigFile{}, err
+		}
+	}
+
+	if f.Config.Database.PasswordFromStdin {
+		f.Config.Database.Password, err = passwordFromStdin()
+		if err != nil {
+			return ConfigFile{}, err
+		}
+	}
+
+	return f, nil
+}
+
+// validateScriptsDir ensures migrationScriptsDir, and downScriptsDir
+// if set, stay within the project root. Relative paths may not use ..
+// to escape the project and absolute paths are rejected unless
+// allowAbsoluteScriptsDir is set.
+func validateScriptsDir(f ConfigFile) error {
+	err := validateProjectDir("migrationScriptsDir", f.Config.MigrationScriptsDir, f.Config.AllowAbsoluteScriptsDir)
+	if err != nil {
+		return err
+	}
+
+	dir := f.Config.DownScriptsDir
+	if dir == "" {
+		return nil
+	}
+	if f.Config.Layout == SuffixLayout {
+		return fmt.Errorf("downScriptsDir cannot be used with the %s layout", SuffixLayout)
+	}
+	if isArchive(dir) {
+		return fmt.Errorf("downScriptsDir %q cannot be an archive", dir)
+	}
+	return validateProjectDir("downScriptsDir", dir, f.Config.AllowAbsoluteScriptsDir)
+}
+
+// validateProjectDir ensures the directory configured in field stays
+// within the project root
+func validateProjectDir(field, dir string, allowAbsolute bool) error {
+	if filepath.IsAbs(dir) {
+		if allowAbsolute {
+			return nil
+		}
+		return fmt.Errorf("%s %q is absolute, set allowAbsoluteScriptsDir to permit it", field, dir)
+	}
+
+	clean := filepath.Clean(dir)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s %q escapes the project root", field, dir)
+	}
+
+	return nil
+}
+
+// modeledParams are the connection parameters set from their own
+// config fields, which may not be repeated in params
+var modeledParams = map[string]bool{
+	"host":            true,
+	"port":            true,
+	"dbname":          true,
+	"user":            true,
+	"password":        true,
+	"options":         true,
+	"client_encoding": true,
+	"sslmode":         true,
+}
+
+// validateParams rejects params which are empty or would override a
+// connection parameter gograte sets itself
+func validateParams(params map[string]string) error {
+	for k := range params {
+		switch {
+		case !unquotedIdentifierRegexp.MatchString(k):
+			return fmt.Errorf("invalid connection parameter name %q", k)
+		case modeledParams[k]:
+			return fmt.Errorf("connection parameter %q cannot be set in params, use its own config field", k)
+		}
 	}
+	return nil
+}
+
+// clientMinMessagesLevels are the values client_min_messages accepts
+var clientMinMessagesLevels = []string{"debug5", "debug4", "debug3", "debug2", "debug1", "log", "notice", "warning", "error"}
 
-	if len(ddlFiles) == 0 {
-		return nil, fmt.Errorf("there are no DDL files to process in %s", dir)
+// validateClientMinMessages ensures level is a client_min_messages
+// level, as it is written into a SET statement
+func validateClientMinMessages(level string) error {
+	if level == "" {
+		return nil
+	}
+	for _, l := range clientMinMessagesLevels {
+		if level == l {
+			return nil
+		}
 	}
+	return fmt.Errorf("invalid psql clientMinMessages %q: must be one of %s", level, strings.Join(clientMinMessagesLevels, ", "))
+}
 
-	// command line args for psql are constructed
-	args := []string{"-w", "-d", newPostgreSQLDSN(f).ConnectionURI(), "-c", "select current_database(), current_user, version()"}
+// isolationLevels are the transaction isolation levels PostgreSQL accepts
+var isolationLevels = []string{"read uncommitted", "read committed", "repeatable read", "serializable"}
 
-	for _, file := range ddlFiles {
-		args = append(args, "-f")
-		args = append(args, dir+"/"+file.filename)
+// validateIsolationLevel ensures level is a transaction isolation
+// level, as it is written into a SET statement
+func validateIsolationLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	for _, l := range isolationLevels {
+		if level == l {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid psql isolationLevel %q: must be one of %s", level, strings.Join(isolationLevels, ", "))
+}
+
+// BuildDSN loads the config file for the given profile and returns
+// the populated PostgreSQLDSN. Nothing is executed and the database
+// is never contacted, so it can be used purely to generate connection
+// strings (via ConnectionURI or KeywordValueConnectionString) for
+// other tools.
+func BuildDSN(profile string, opts ...Option) (PostgreSQLDSN, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return PostgreSQLDSN{}, err
+	}
+	return newPostgreSQLDSN(f), nil
+}
+
+// BuildReplicaDSN is like BuildDSN, but returns the DSN for read only
+// operations, which connects to the read replica when one is configured.
+func BuildReplicaDSN(profile string, opts ...Option) (PostgreSQLDSN, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return PostgreSQLDSN{}, err
 	}
+	return newReplicaDSN(f), nil
+}
+
+// newReplicaDSN initializes a PostgreSQLDSN for read only operations
+// (e.g. status checks) using the configured read replica host and
+// port. Unset replica fields default to the primary's.
+func newReplicaDSN(f ConfigFile) PostgreSQLDSN {
+	return newPostgreSQLDSN(replicaConfig(f))
+}
 
-	return args, nil
+// replicaConfig returns f changed to connect to the read replica, see
+// newReplicaDSN
+func replicaConfig(f ConfigFile) ConfigFile {
+	if f.Config.Database.Replica.Host != "" {
+		f.Config.Database.Host = f.Config.Database.Replica.Host
+	}
+	if f.Config.Database.Replica.Port != 0 {
+		f.Config.Database.Port = f.Config.Database.Replica.Port
+	}
+	return f
 }
 
 // newPostgreSQLDSN initializes a datastore.PostgreSQLDSN given a Flags struct
 func newPostgreSQLDSN(f ConfigFile) PostgreSQLDSN {
 	return PostgreSQLDSN{
-		Host:       f.Config.Database.Host,
-		Port:       f.Config.Database.Port,
-		DBName:     f.Config.Database.Name,
-		SearchPath: f.Config.Database.SearchPath,
-		User:       f.Config.Database.User,
-		Password:   f.Config.Database.Password,
+		Host:           f.Config.Database.Host,
+		Port:           f.Config.Database.Port,
+		DBName:         f.Config.Database.Name,
+		SearchPath:     f.Config.Database.SearchPath,
+		User:           f.Config.Database.User,
+		Password:       f.Config.Database.Password,
+		Options:        f.Config.Database.Options,
+		ClientEncoding: f.Config.Database.ClientEncoding,
+		Params:         f.Config.Database.Params,
+		AppName:        f.applicationName(),
 	}
 }
 
+// defaultApplicationName tags connections made by psql when
+// database.applicationName is not configured
+const defaultApplicationName = "gograte"
+
+// applicationName returns the configured application name, or the default
+func (f ConfigFile) applicationName() string {
+	if f.Config.Database.ApplicationName != "" {
+		return f.Config.Database.ApplicationName
+	}
+	return defaultApplicationName
+}
+
 // PostgreSQLDSN is a PostgreSQL datasource name
 type PostgreSQLDSN struct {
 	Host       string
@@ -152,6 +556,50 @@ type PostgreSQLDSN struct {
 	SearchPath string
 	User       string
 	Password   string
+	// Options are additional run-time parameters set at connection
+	// startup, e.g. timezone=UTC, sent as -c flags in the options
+	// connection parameter
+	Options map[string]string
+	// ClientEncoding sets the client_encoding connection parameter,
+	// e.g. UTF8 or LATIN1. The server default is used when empty.
+	ClientEncoding string
+	// Params are additional libpq connection parameters, e.g.
+	// target_session_attrs=read-write, rendered in key order
+	Params map[string]string
+	// AppName is passed to psql in the PGAPPNAME environment
+	// variable rather than the connection string, so connections
+	// show up under it in pg_stat_activity. An application_name in
+	// Params takes precedence, as libpq prefers the connection string.
+	AppName string
+}
+
+// startupOptions returns the value for the options connection
+// parameter: a -c flag for search_path (if includeSearchPath is true)
+// and for each of Options, in key order. Spaces and backslashes in
+// values are backslash escaped as libpq requires.
+func (dsn PostgreSQLDSN) startupOptions(includeSearchPath bool) string {
+	esc := strings.NewReplacer(`\`, `\\`, " ", `\ `)
+
+	var opts []string
+	if includeSearchPath && dsn.SearchPath != "" {
+		opts = append(opts, "-csearch_path="+esc.Replace(quoteSearchPath(dsn.SearchPath)))
+	}
+
+	for _, k := range sortedKeys(dsn.Options) {
+		opts = append(opts, "-c"+k+"="+esc.Replace(dsn.Options[k]))
+	}
+
+	return strings.Join(opts, " ")
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // ConnectionURI returns a formatted PostgreSQL datasource "Keyword/Value Connection String"
@@ -191,6 +639,8 @@ func (dsn PostgreSQLDSN) ConnectionURI() string {
 		h += ":" + strconv.Itoa(dsn.Port)
 	}
 
+	// url.URL percent-encodes the path segment, so database names
+	// with mixed case or special characters (e.g. My-DB) survive as is
 	u := url.URL{
 		Scheme: uriSchemeDesignator,
 		User:   url.User(dsn.User),
@@ -198,9 +648,26 @@ func (dsn PostgreSQLDSN) ConnectionURI() string {
 		Path:   dsn.DBName,
 	}
 
-	if dsn.SearchPath != "" {
+	// search_path and any other startup options are folded into
+	// a single options parameter
+	if opts := dsn.startupOptions(true); opts != "" {
+		q := u.Query()
+		q.Set("options", opts)
+		u.RawQuery = q.Encode()
+	}
+
+	if dsn.ClientEncoding != "" {
 		q := u.Query()
-		q.Set("options", fmt.Sprintf("-csearch_path=%s", dsn.SearchPath))
+		q.Set("client_encoding", dsn.ClientEncoding)
+		u.RawQuery = q.Encode()
+	}
+
+	// url.Values.Encode sorts by key
+	if len(dsn.Params) > 0 {
+		q := u.Query()
+		for k, v := range dsn.Params {
+			q.Set(k, v)
+		}
 		u.RawQuery = q.Encode()
 	}
 
@@ -216,9 +683,22 @@ func (dsn PostgreSQLDSN) KeywordValueConnectionString() string {
 	// the password parameter must be removed from the string, otherwise the connection will fail.
 	switch dsn.Password {
 	case "":
-		s = fmt.Sprintf("host=%s port=%d dbname=%s user=%s sslmode=disable", dsn.Host, dsn.Port, dsn.DBName, dsn.User)
+		s = fmt.Sprintf("host=%s port=%d dbname=%s user=%s sslmode=disable", quoteKeywordValue(dsn.Host), dsn.Port, quoteKeywordValue(dsn.DBName), quoteKeywordValue(dsn.User))
 	default:
-		s = fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=disable", dsn.Host, dsn.Port, dsn.DBName, dsn.User, dsn.Password)
+		s = fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=disable", quoteKeywordValue(dsn.Host), dsn.Port, quoteKeywordValue(dsn.DBName), quoteKeywordValue(dsn.User), quoteKeywordValue(dsn.Password))
+	}
+
+	// any other startup options are set using the options keyword
+	if opts := dsn.startupOptions(false); opts != "" {
+		s += " " + fmt.Sprintf("options=%s", quoteKeywordValue(opts))
+	}
+
+	if dsn.ClientEncoding != "" {
+		s += " " + fmt.Sprintf("client_encoding=%s", quoteKeywordValue(dsn.ClientEncoding))
+	}
+
+	for _, k := range sortedKeys(dsn.Params) {
+		s += " " + fmt.Sprintf("%s=%s", k, quoteKeywordValue(dsn.Params[k]))
 	}
 
 	// if search path needs to be explicitly set, will be added to the end of the datasource string
@@ -226,8 +706,124 @@ func (dsn PostgreSQLDSN) KeywordValueConnectionString() string {
 	case "":
 		return s
 	default:
-		return s + " " + fmt.Sprintf("search_path=%s", dsn.SearchPath)
+		return s + " " + fmt.Sprintf("search_path=%s", quoteKeywordValue(quoteSearchPath(dsn.SearchPath)))
+	}
+}
+
+// secretParams are the connection parameters Redacted hides
+var secretParams = map[string]bool{
+	"sslpassword": true,
+}
+
+// Redacted returns the KeywordValueConnectionString with the password,
+// and any params holding a secret, replaced by ***, e.g. password=***,
+// so the connection can be printed or logged to confirm the target
+// before running.
+func (dsn PostgreSQLDSN) Redacted() string {
+	if dsn.Password != "" {
+		dsn.Password = "***"
+	}
+	params := make(map[string]string, len(dsn.Params))
+	for k, v := range dsn.Params {
+		if secretParams[k] {
+			v = "***"
+		}
+		params[k] = v
 	}
+	dsn.Params = params
+	return dsn.KeywordValueConnectionString()
+}
+
+// EnvExports returns the connection as libpq environment variable
+// assignments, e.g. PGHOST=localhost, quoted for a POSIX shell so a
+// wrapper script can eval them to set up a psql session. Unset fields
+// are left out. The password is included as is, so the output must
+// not be logged.
+func (dsn PostgreSQLDSN) EnvExports() []string {
+	var env []string
+	add := func(name, value string) {
+		if value != "" {
+			env = append(env, name+"="+shellQuote(value))
+		}
+	}
+
+	add("PGHOST", dsn.Host)
+	if dsn.Port != 0 {
+		add("PGPORT", strconv.Itoa(dsn.Port))
+	}
+	add("PGDATABASE", dsn.DBName)
+	add("PGUSER", dsn.User)
+	add("PGPASSWORD", dsn.Password)
+	add("PGOPTIONS", dsn.startupOptions(true))
+	add("PGCLIENTENCODING", dsn.ClientEncoding)
+	add("PGAPPNAME", dsn.AppName)
+
+	return env
+}
+
+// quoteKeywordValue quotes a value for a keyword/value connection
+// string. Values which are empty or contain whitespace, single quotes
+// or backslashes are surrounded with single quotes and escaped.
+func quoteKeywordValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n\r'\\") {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(v) + "'"
+}
+
+// unquotedIdentifierRegexp matches identifiers Postgres does not
+// require to be double-quoted.
+var unquotedIdentifierRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// quoteIdentifier double-quotes a Postgres identifier if it contains
+// uppercase or special characters, otherwise it is returned as is.
+// Identifiers which are already double-quoted are left alone.
+func quoteIdentifier(id string) string {
+	if unquotedIdentifierRegexp.MatchString(id) || (len(id) > 1 && strings.HasPrefix(id, `"`) && strings.HasSuffix(id, `"`)) {
+		return id
+	}
+	return `"` + strings.ReplaceAll(id, `"`, `""`) + `"`
+}
+
+// maxIdentifierLength is the maximum length of a Postgres identifier in bytes
+const maxIdentifierLength = 63
+
+// validateIdentifier ensures id can be used as a Postgres identifier
+func validateIdentifier(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("identifier is empty")
+	case len(id) > maxIdentifierLength:
+		return fmt.Errorf("identifier %q is longer than %d bytes", id, maxIdentifierLength)
+	case strings.ContainsRune(id, 0):
+		return fmt.Errorf("identifier %q contains a NUL character", id)
+	}
+	return nil
+}
+
+// searchPathSchemas returns the schemas named in a comma separated
+// search_path, skipping the special $user entry
+func searchPathSchemas(searchPath string) []string {
+	var schemas []string
+	for _, schema := range strings.Split(searchPath, ",") {
+		schema = strings.TrimSpace(schema)
+		if schema == "" || schema == "$user" || schema == `"$user"` {
+			continue
+		}
+		schemas = append(schemas, strings.Trim(schema, `"`))
+	}
+	return schemas
+}
+
+// quoteSearchPath quotes each schema in a comma separated search_path
+// which needs it.
+func quoteSearchPath(searchPath string) string {
+	schemas := strings.Split(searchPath, ",")
+	for i, schema := range schemas {
+		schemas[i] = quoteIdentifier(strings.TrimSpace(schema))
+	}
+	return strings.Join(schemas, ",")
 }
 
 // ConfigFile defines the configuration file.
@@ -240,21 +836,321 @@ type ConfigFile struct {
 			User       string `json:"user"`
 			Password   string `json:"password"`
 			SearchPath string `json:"searchPath"`
+			// PasswordFromStdin, when true, reads Password from
+			// stdin (prompting if stdin is a terminal) instead of
+			// the config file. The password is passed to psql in
+			// the PGPASSWORD environment variable, never as an arg.
+			PasswordFromStdin bool `json:"passwordFromStdin"`
+			// Options are run-time parameters set at connection
+			// startup, e.g. {"timezone": "UTC"}
+			Options map[string]string `json:"options"`
+			// ClientEncoding sets the client_encoding of the
+			// connection, e.g. UTF8, for when migration files
+			// contain non-ASCII and the server encoding differs.
+			// The server default is used when empty.
+			ClientEncoding string `json:"clientEncoding"`
+			// Params are additional libpq connection parameters
+			// gograte does not model, e.g.
+			// {"target_session_attrs": "read-write"}
+			Params map[string]string `json:"params"`
+			// ApplicationName is set as PGAPPNAME for psql,
+			// defaults to gograte
+			ApplicationName string `json:"applicationName"`
+			// MaintenanceDatabase is connected to when creating and
+			// dropping the throwaway database of WithTempDB,
+			// defaults to postgres
+			MaintenanceDatabase string `json:"maintenanceDatabase"`
+			// Replica optionally declares a read replica used for
+			// read only operations such as status checks, so they
+			// do not load the primary. Migrations always run
+			// against the primary.
+			Replica struct {
+				Host string `json:"host"`
+				Port int    `json:"port"`
+			} `json:"replica"`
+			// CreateSchemas, when true, creates each schema in
+			// SearchPath (if it does not exist) before running any
+			// files
+			CreateSchemas bool `json:"createSchemas"`
+			// VerifyCurrentDatabase, when true, aborts the migration
+			// before any DDL runs if current_database() reported by
+			// the server does not match Name
+			VerifyCurrentDatabase bool `json:"verifyCurrentDatabase"`
+			// RequiredPrivileges are checked by
+			// PreflightPermissions, defaults are used for any
+			// list which is not set
+			RequiredPrivileges struct {
+				// Database privileges, e.g. CONNECT or CREATE
+				Database []string `json:"database"`
+				// Schema privileges held on each schema in
+				// SearchPath, e.g. USAGE or CREATE
+				Schema []string `json:"schema"`
+			} `json:"requiredPrivileges"`
 		} `json:"database"`
+		// MigrationScriptsDir is the directory holding the up and
+		// down directories, or a .zip or .tar.gz archive with up and
+		// down directories at its root
 		MigrationScriptsDir string `json:"migrationScriptsDir"`
+		// DownScriptsDir, when set, is the directory holding the
+		// down files in place of the down directory of
+		// MigrationScriptsDir, so rollbacks can be stored and
+		// reviewed separately. It cannot be an archive or be used
+		// with the suffix layout.
+		DownScriptsDir string `json:"downScriptsDir"`
+		// AllowEmptyDown, for forward only migrations, makes a down
+		// run with no down files, or no down directory, return
+		// ErrNoMigrations, which callers treat as success, rather
+		// than an error
+		AllowEmptyDown bool `json:"allowEmptyDown"`
+		// AllowAbsoluteScriptsDir permits an absolute
+		// MigrationScriptsDir or DownScriptsDir outside of the
+		// project root
+		AllowAbsoluteScriptsDir bool `json:"allowAbsoluteScriptsDir"`
+		// Component namespaces the migrations of one application
+		// component in a shared database: its files are read from
+		// the component's subdirectory of MigrationScriptsDir, its
+		// name is appended to the tracking table name and it is
+		// used in the advisory lock key
+		Component string `json:"component"`
+		// Layout is how up and down files are told apart: subdirs
+		// (default) for up and down directories, or suffix for a
+		// single directory of .up.sql and .down.sql files
+		Layout string `json:"layout"`
+		// NamingScheme is the DDL file naming scheme, either
+		// sequence (default) or timestamp
+		NamingScheme string `json:"namingScheme"`
+		// FileNumberWidth is the zero padded width of file number
+		// prefixes, e.g. 3 for 001-user.sql. If 0, the width of the
+		// first file is used. Verify warns about files that differ.
+		FileNumberWidth int `json:"fileNumberWidth"`
+		// StrictFileNumberWidth makes file number width warnings
+		// verification errors
+		StrictFileNumberWidth bool `json:"strictFileNumberWidth"`
+		// Protected marks a profile (e.g. production) where
+		// destructive statements must be confirmed before running
+		Protected bool `json:"protected"`
+		// DestructiveStatements are the keywords which mark a
+		// statement as destructive in protected profiles, defaults
+		// to DROP TABLE, DROP SCHEMA, DROP DATABASE, DROP COLUMN,
+		// TRUNCATE and DELETE FROM
+		DestructiveStatements []string `json:"destructiveStatements"`
+		// ExcludeFiles are files, by number or filename, which are
+		// never run for this profile, e.g. a tenant specific file
+		ExcludeFiles []string `json:"excludeFiles"`
+		// IncludeOnly, when set, restricts the run to the listed
+		// files, by number or filename
+		IncludeOnly []string `json:"includeOnly"`
+		// BaselineVersion, when set, is the file number at or below
+		// which files are assumed to be applied, e.g. on a database
+		// which predates gograte. Those files are never run, up or
+		// down, whether or not the tracking table has rows for them,
+		// and nothing is recorded for them. Status and HasPending do
+		// not report them as pending. Unlike MarkApplied, no
+		// tracking rows are needed, so the same config works for
+		// new and existing databases.
+		BaselineVersion int `json:"baselineVersion"`
+		// Template, when enabled, renders each DDL file as a Go
+		// text/template before it runs, so one file can use
+		// per-profile values such as tablespace or role names,
+		// e.g. {{.Vars.tablespace}} or {{.Config.Database.User}}
+		Template struct {
+			Enabled bool              `json:"enabled"`
+			Vars    map[string]string `json:"vars"`
+		} `json:"template"`
+		PSQL struct {
+			// ExtraArgs are additional psql flags (e.g. --no-psqlrc)
+			// added after the connection flags and before the files.
+			// Flags gograte manages (-d, -f, -w, -W) are rejected.
+			ExtraArgs []string `json:"extraArgs"`
+			// PasswordPrompt controls whether psql prompts for a
+			// password: never (-w, default), always (-W) or auto
+			// (neither flag) for interactive use
+			PasswordPrompt string `json:"passwordPrompt"`
+			// EchoQueries passes --echo-queries so each statement
+			// psql sends to the server is written to the output
+			EchoQueries bool `json:"echoQueries"`
+			// SingleTransaction runs files inside a transaction so
+			// a failure rolls back the whole batch. Files with a
+			// "-- gograte:no-transaction" header comment (e.g. for
+			// CREATE INDEX CONCURRENTLY) run outside of it.
+			SingleTransaction bool `json:"singleTransaction"`
+			// SingleTransactionUp and SingleTransactionDown enable
+			// SingleTransaction for one direction only, e.g. so
+			// rollbacks are all or nothing while up files using
+			// CONCURRENTLY are not wrapped
+			SingleTransactionUp   bool `json:"singleTransactionUp"`
+			SingleTransactionDown bool `json:"singleTransactionDown"`
+			// MinVersion is the minimum psql client version
+			// required, e.g. "12" or "9.6". Migrations fail early
+			// when an older client is installed.
+			MinVersion string `json:"minVersion"`
+			// IncludeScript runs files from a temporary master
+			// script which includes each file with \i, keeping
+			// the command line short for hundreds of files
+			IncludeScript bool `json:"includeScript"`
+			// ConnectAttempts is how many times the diagnostic query
+			// is tried, with a doubling backoff, before a migration
+			// is resolved and run. It defaults to 1 (no retry).
+			ConnectAttempts int `json:"connectAttempts"`
+			// ClientMinMessages, e.g. "warning", is SET before any
+			// files run to silence NOTICE messages such as
+			// "relation already exists, skipping". The server
+			// default is used when empty.
+			ClientMinMessages string `json:"clientMinMessages"`
+			// IsolationLevel, e.g. "serializable", sets the default
+			// transaction isolation level of the session before any
+			// files run, for data migrations which need REPEATABLE
+			// READ or SERIALIZABLE. The server default is used when
+			// empty.
+			IsolationLevel string `json:"isolationLevel"`
+			// SlowFileThreshold, e.g. "5m", makes RunTimed warn
+			// about each file which takes longer to run
+			SlowFileThreshold string `json:"slowFileThreshold"`
+			// FastUnsafe SETs synchronous_commit off for the
+			// session, so commits do not wait for the WAL to be
+			// flushed, which speeds up setting up disposable test
+			// databases. A crash can lose recently committed
+			// migrations, so it is UNSAFE FOR PRODUCTION and is
+			// rejected in protected profiles.
+			FastUnsafe bool `json:"fastUnsafe"`
+			// Output toggles psql flags which keep output clean
+			// when it is captured by automation. By default psql's
+			// normal, verbose output is kept.
+			Output struct {
+				// Automation turns on Quiet, PagerOff and Terse
+				Automation bool `json:"automation"`
+				// Quiet passes -q, dropping command tags such as
+				// CREATE TABLE from the output
+				Quiet bool `json:"quiet"`
+				// PagerOff passes --pset pager=off
+				PagerOff bool `json:"pagerOff"`
+				// Terse passes -v VERBOSITY=terse, shortening
+				// error messages to a single line
+				Terse bool `json:"terse"`
+			} `json:"output"`
+		} `json:"psql"`
+		// AdvisoryLock, when enabled, takes a Postgres advisory
+		// lock before any files run so concurrent migrations of
+		// the same database wait for each other. A run made in a
+		// single psql invocation (Run, PSQLArgs) takes it in that
+		// session, while runs which invoke psql per file
+		// (RunEachFile, RunWithProgress, RunTimed and manifest
+		// tracking) hold it in a psql session of their own.
+		AdvisoryLock struct {
+			Enabled bool `json:"enabled"`
+			// Key is the lock key, defaults to a hash of the
+			// database name (see AdvisoryLockKey)
+			Key int64 `json:"key"`
+		} `json:"advisoryLock"`
+		// SSHTunnel, when Host is set, makes every connection to
+		// the database go through an SSH tunnel via the Host
+		// bastion. The tunnel is opened with the system ssh
+		// client, not golang.org/x/crypto/ssh, so the user's ssh
+		// config, known_hosts and agent apply. It is opened only
+		// for the calls which connect, e.g. Run, Status or Plan
+		// with tracking enabled, and closed before they return.
+		// PSQLArgs and WriteRunScript refuse such a profile, as
+		// their output could not connect once the tunnel closed.
+		SSHTunnel struct {
+			Host string `json:"host"`
+			// Port is the bastion's SSH port, defaults to 22
+			Port int    `json:"port"`
+			User string `json:"user"`
+			// KeyPath is the private key, ssh's defaults and
+			// agent are used when empty
+			KeyPath string `json:"keyPath"`
+			// LocalPort is the local end of the tunnel,
+			// defaults to a free port
+			LocalPort int `json:"localPort"`
+		} `json:"sshTunnel"`
+		// Webhook, when URL is set, is POSTed a JSON
+		// WebhookPayload after Run and RunTimed, e.g. a Slack
+		// incoming webhook. A failed notification is reported as
+		// a warning and does not fail the migration.
+		Webhook struct {
+			URL string `json:"url"`
+		} `json:"webhook"`
+		Tracking struct {
+			// Enabled turns on recording of applied migrations
+			// in the tracking table. gograte has no database/sql
+			// backend, so a file's DDL and its tracking row are
+			// only committed atomically when psql.singleTransaction
+			// is also set: the row is then written in the same
+			// transaction as the file. Otherwise, and for
+			// no-transaction files, a failure leaves the file
+			// recorded as dirty rather than rolled back.
+			Enabled bool `json:"enabled"`
+			// Table is the name of the tracking table, defaults
+			// to schema_migrations
+			Table string `json:"table"`
+			// Manifest, when set, tracks applied migrations in a
+			// JSON file instead of the tracking table, for databases
+			// where gograte may not create one. "default" uses
+			// .gograte-applied.json in ConfigDir. Files are then run
+			// one psql invocation at a time so each can be recorded
+			// as it succeeds. The manifest can drift from the actual
+			// database state, e.g. if it is lost or reverted, so the
+			// tracking table remains the default. psql args from
+			// PSQLArgs do not update the manifest.
+			Manifest string `json:"manifest"`
+			// AbortIfAhead, when true, aborts a migration if the
+			// highest applied file number is greater than the
+			// highest local one, so a rollback deploy of an older
+			// build does not run against a newer database
+			AbortIfAhead bool `json:"abortIfAhead"`
+		} `json:"tracking"`
 	} `json:"config"`
+
+	// configDir is the directory the file was loaded from when it
+	// was loaded for a base directory, see WithBaseDir
+	configDir string
+}
+
+// outputArgs returns the psql flags for the configured output toggles
+func (f ConfigFile) outputArgs() []string {
+	o := f.Config.PSQL.Output
+	var args []string
+	if o.Automation || o.Quiet {
+		args = append(args, "-q")
+	}
+	if o.Automation || o.PagerOff {
+		args = append(args, "--pset", "pager=off")
+	}
+	if o.Automation || o.Terse {
+		args = append(args, "-v", "VERBOSITY=terse")
+	}
+	return args
+}
+
+// singleTransaction reports whether files run in the given direction
+// are wrapped in a transaction
+func (f ConfigFile) singleTransaction(up bool) bool {
+	psql := f.Config.PSQL
+	if up {
+		return psql.SingleTransaction || psql.SingleTransactionUp
+	}
+	return psql.SingleTransaction || psql.SingleTransactionDown
+}
+
+// namingScheme returns the configured naming scheme, defaulting to SequenceNaming
+func (f ConfigFile) namingScheme() string {
+	if f.Config.NamingScheme == "" {
+		return SequenceNaming
+	}
+	return f.Config.NamingScheme
 }
 
 // NewConfigFile initializes a Config struct from a JSON file at a
 // predetermined file path (path is relative to project root)
 //
 // Local:      ./config/local.json
+//
+// configFilePath may also be an http(s):// URL, or a URL with any
+// scheme registered with RegisterConfigFetcher, in which case the JSON
+// is fetched over the network. Setting GOGRATE_CONFIG_DIR to a URL
+// loads every profile remotely.
 func NewConfigFile(configFilePath string) (ConfigFile, error) {
-	var (
-		b   []byte
-		err error
-	)
-	b, err = os.ReadFile(configFilePath)
+	b, err := readConfig(configFilePath)
 	if err != nil {
 		return ConfigFile{}, err
 	}
@@ -276,18 +1172,72 @@ type ConfigCueFilePaths struct {
 	Output string
 }
 
+// readConfig returns the JSON config at configFilePath, a file path or
+// a URL (see NewConfigFile)
+func readConfig(configFilePath string) ([]byte, error) {
+	if u, ok := remoteConfigURL(configFilePath); ok {
+		return readRemoteConfig(u)
+	}
+	return os.ReadFile(configFilePath)
+}
+
 // CUEPaths returns the ConfigCueFilePaths.
-// Paths are relative to the project root.
-func CUEPaths(profile string) ConfigCueFilePaths {
-	const schemaInput = "./config/cue/schema.cue"
+// Paths are relative to the project root. The JSON output is written
+// to outputDir, or to ./config if outputDir is empty.
+func CUEPaths(profile, outputDir string) ConfigCueFilePaths {
+	const schemaInput = cueDir + "/" + cueSchemaFile
+
+	if outputDir == "" {
+		outputDir = defaultConfigDir
+	}
 
 	// cue config path - relative to project root
-	profileInput := "./config/cue/" + profile + ".cue"
+	profileInput := cueDir + "/" + profile + ".cue"
 	// regular config path - relative to project root
-	profileOutput := "./config/" + profile + ".json"
+	profileOutput := outputDir + "/" + profile + ".json"
 
 	return ConfigCueFilePaths{
 		Input:  []string{schemaInput, profileInput},
 		Output: profileOutput,
 	}
 }
+
+// In returns the paths within baseDir, for a project rooted outside
+// the working directory (see WithBaseDir). Absolute paths are kept.
+func (p ConfigCueFilePaths) In(baseDir string) ConfigCueFilePaths {
+	in := ConfigCueFilePaths{Output: inBaseDir(baseDir, p.Output)}
+	for _, path := range p.Input {
+		in.Input = append(in.Input, inBaseDir(baseDir, path))
+	}
+	return in
+}
+
+const (
+	// cueDir holds the CUE schema and profile files, relative to
+	// the project root
+	cueDir = "./config/cue"
+	// cueSchemaFile is the schema every profile is vetted against
+	cueSchemaFile = "schema.cue"
+)
+
+// ListProfiles returns the names of the config profiles which have a
+// CUE file in ./config/cue, in sorted order. schema.cue is not a
+// profile and is skipped.
+func ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(cueDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == cueSchemaFile || !strings.HasSuffix(name, ".cue") {
+			continue
+		}
+		profiles = append(profiles, strings.TrimSuffix(name, ".cue"))
+	}
+
+	// os.ReadDir returns entries sorted by filename
+	return profiles, nil
+}
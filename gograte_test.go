@@ -0,0 +1,129 @@
+package gograte
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestByFileNumberTiebreak(t *testing.T) {
+	want := []string{"001-a.sql", "001-b.sql", "001-c.sql", "002-a.sql", "010-a.sql"}
+	orders := [][]string{
+		{"010-a.sql", "001-c.sql", "002-a.sql", "001-a.sql", "001-b.sql"},
+		{"001-b.sql", "001-c.sql", "001-a.sql", "010-a.sql", "002-a.sql"},
+		{"001-c.sql", "001-b.sql", "010-a.sql", "002-a.sql", "001-a.sql"},
+	}
+	for _, names := range orders {
+		ddlFiles := make([]ddlFile, len(names))
+		for i, name := range names {
+			df, err := newDDLFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ddlFiles[i] = df
+		}
+		sort.Sort(byFileNumber(ddlFiles))
+
+		got := make([]string, len(ddlFiles))
+		for i, df := range ddlFiles {
+			got[i] = df.filename
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sorted %q to %q, want %q", names, got, want)
+		}
+	}
+}
+
+func TestEqualFileNumbersRunInFilenameOrder(t *testing.T) {
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/up", "002-b.sql", "001-b.sql", "001-a.sql")
+	writeFiles(t, scriptsDir+"/down", "002-b.sql", "001-b.sql", "001-a.sql")
+
+	for _, tt := range []struct {
+		up   bool
+		want []string
+	}{
+		{up: true, want: []string{"001-a.sql", "001-b.sql", "002-b.sql"}},
+		{up: false, want: []string{"002-b.sql", "001-b.sql", "001-a.sql"}},
+	} {
+		args, err := PSQLArgs(tt.up, testProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range fileArgsOrder(args) {
+			got = append(got, filepath.Base(f))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("up %t: files run in order %q, want %q", tt.up, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFilename(t *testing.T) {
+	for _, name := range []string{"001-create_user.sql", "1-a.sql", "20240115093000-add_index.sql"} {
+		err := ValidateFilename(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		problem string
+	}{
+		{name: "create_user.sql", problem: "missing dash"},
+		{name: "-create_user.sql", problem: "missing file number"},
+		{name: "v1-create_user.sql", problem: "not numeric"},
+		{name: "001-create_user.txt", problem: "missing .sql extension"},
+		{name: "001-.sql", problem: "missing name"},
+		{name: "000-create_user.sql", problem: "file numbers start at 1"},
+		{name: "123456789012345-create_user.sql", problem: "longer than"},
+	}
+	for _, tt := range tests {
+		err := ValidateFilename(tt.name)
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.problem) || !strings.Contains(err.Error(), filenameFormat) {
+			t.Errorf("%s: error %q does not say %q and the expected format", tt.name, err, tt.problem)
+		}
+	}
+}
+
+func TestNewDDLFileNumberRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    int
+		wantErr string
+	}{
+		{name: "001-user.sql", want: 1},
+		{name: "20240115093000-user.sql", want: 20240115093000},
+		{name: "00000000000000000042-user.sql", want: 42},
+		{name: "-1-user.sql", wantErr: "negative numbers are not allowed"},
+		{name: "+1-user.sql", wantErr: "not a whole number"},
+		{name: "0-user.sql", wantErr: "file numbers start at 1"},
+		{name: "000-user.sql", wantErr: "file numbers start at 1"},
+		{name: "99999999999999999999-user.sql", wantErr: "longer than 14 digits"},
+		{name: "9223372036854775808-user.sql", wantErr: "longer than 14 digits"},
+	}
+	for _, tt := range tests {
+		df, err := newDDLFile(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newDDLFile(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newDDLFile(%q): %v", tt.name, err)
+			continue
+		}
+		if df.fileNumber != tt.want {
+			t.Errorf("newDDLFile(%q) file number = %d, want %d", tt.name, df.fileNumber, tt.want)
+		}
+	}
+}
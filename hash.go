@@ -0,0 +1,107 @@
+package gograte
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MigrationSetHash returns the hex encoded SHA-256 digest of the DDL
+// files in dir (e.g. ./scripts/db/migrations/up): the name and content
+// of each file, in the order the files are run. The hash changes when
+// any file is added, removed, renamed, edited or reordered, so a
+// service can store it and skip migration work while it is unchanged.
+//
+// File names are parsed with the sequence naming scheme, which also
+// covers timestamp prefixes.
+func MigrationSetHash(dir string) (string, error) {
+	ddlFiles, err := readDDLFiles(dir, SequenceNaming, "")
+	if err != nil {
+		return "", err
+	}
+	return hashFiles(dir, ddlFiles)
+}
+
+// hashFiles returns the hex encoded SHA-256 digest of the name and
+// content of each of ddlFiles, found in dir, in order
+func hashFiles(dir string, ddlFiles []ddlFile) (string, error) {
+	h := sha256.New()
+	for _, df := range ddlFiles {
+		err := hashFile(h, dir+"/"+df.filename, df.filename)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile writes the length prefixed name and content of the file at
+// path to h, streaming the content so large files are not held in memory
+func hashFile(h io.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var fi os.FileInfo
+	fi, err = file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// length prefixes keep a name and content boundary from
+	// being shifted without changing the hash
+	fmt.Fprintf(h, "%d:%s%d:", len(name), name, fi.Size())
+	var n int64
+	n, err = io.Copy(h, file)
+	if err != nil {
+		return err
+	}
+	if n != fi.Size() {
+		return fmt.Errorf("%s changed while it was being hashed", path)
+	}
+	return nil
+}
+
+// expectedHashEnv names the environment variable which, when set,
+// gates up migrations on the hash of the pending set, see WithExpectedHash
+const expectedHashEnv = "GOGRATE_EXPECTED_HASH"
+
+// ErrHashMismatch is returned when the pending migration set does not
+// have the expected hash
+var ErrHashMismatch = errors.New("pending migrations do not match the expected hash")
+
+// PendingSetHash returns the hash, as computed by MigrationSetHash, of
+// the files the migration for the given direction and profile would
+// run. It is the value reviewers approve and pass to WithExpectedHash.
+func PendingSetHash(up bool, profile string, opts ...Option) (string, error) {
+	m, err := newMigration(up, profile, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer m.close()
+	return hashFiles(m.dir, m.files)
+}
+
+// checkExpectedHash compares the hash of the migration's files with
+// the expected hash, if any, returning ErrHashMismatch with both
+// hashes if they differ. Every runner calls it before executing
+// anything.
+func (m migration) checkExpectedHash() error {
+	if m.expectedHash == "" {
+		return nil
+	}
+	actual, err := hashFiles(m.dir, m.files)
+	if err != nil {
+		return err
+	}
+	if actual != m.expectedHash {
+		return fmt.Errorf("%w: expected %s, got %s", ErrHashMismatch, m.expectedHash, actual)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package gograte
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpectedHashOnlyGatesExecution(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+	t.Setenv(expectedHashEnv, "not-the-reviewed-hash")
+
+	_, err := Plan(true, testProfile)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	_, err = PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatalf("PSQLArgs: %v", err)
+	}
+	_, err = ListMigrations(true, testProfile)
+	if err != nil {
+		t.Fatalf("ListMigrations: %v", err)
+	}
+	_, err = MigrationFileCount(true, testProfile)
+	if err != nil {
+		t.Fatalf("MigrationFileCount: %v", err)
+	}
+
+	runners := map[string]func() error{
+		"Run":         func() error { return Run(true, testProfile) },
+		"RunEachFile": func() error { return RunEachFile(true, testProfile) },
+		"RunWithProgress": func() error {
+			return RunWithProgress(true, testProfile, nil)
+		},
+		"RunTimed": func() error { _, err := RunTimed(true, testProfile); return err },
+	}
+	for name, run := range runners {
+		err = run()
+		if !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%s: err = %v, want ErrHashMismatch", name, err)
+		}
+	}
+	for _, call := range psqlCalls(t, log) {
+		if len(fileArgsOrder(call)) > 0 {
+			t.Fatalf("files ran despite the hash mismatch: %q", call)
+		}
+	}
+
+	var hash string
+	hash, err = PendingSetHash(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(expectedHashEnv, hash)
+	err = Run(true, testProfile)
+	if err != nil {
+		t.Fatalf("Run with the reviewed hash: %v", err)
+	}
+}
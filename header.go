@@ -0,0 +1,114 @@
+package gograte
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxHeaderLines is the number of lines at the top of a DDL file
+// scanned for header comments
+const maxHeaderLines = 20
+
+// maxHeaderLine is the longest line read as a header comment. A longer
+// line, e.g. a minified statement or a bulk INSERT, ends the headers.
+const maxHeaderLine = 4096
+
+// fileHeaders holds the optional metadata declared in comment lines
+// at the top of a DDL file, e.g.
+//
+//	-- author: jane
+//	-- ticket: JIRA-123
+//	-- gograte:no-transaction
+//	-- gograte:schema billing
+//	-- gograte:tags billing,reporting
+type fileHeaders struct {
+	author string
+	ticket string
+	// noTransaction marks a file which cannot run inside a
+	// transaction block, e.g. CREATE INDEX CONCURRENTLY
+	noTransaction bool
+	// schema overrides the search_path while the file runs
+	schema string
+	// tags select the file for runs restricted with WithTag
+	tags []string
+}
+
+// readHeaders parses the header comments of the file at path. Only
+// the leading block of comment (or blank) lines is considered, up to
+// maxHeaderLines. Missing headers are left empty.
+func readHeaders(path string) (fileHeaders, error) {
+	r, err := openSQLFile(path)
+	if err != nil {
+		return fileHeaders{}, err
+	}
+	defer r.Close()
+
+	var h fileHeaders
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxHeaderLine)
+	for n := 0; n < maxHeaderLines && s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "--")), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "author":
+			h.author = value
+		case "ticket":
+			h.ticket = value
+		case "gograte":
+			err = h.directive(value)
+			if err != nil {
+				return fileHeaders{}, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	if errors.Is(s.Err(), bufio.ErrTooLong) {
+		return h, nil
+	}
+	return h, s.Err()
+}
+
+// directive applies a gograte: header directive, e.g. no-transaction
+func (h *fileHeaders) directive(d string) error {
+	name, arg, _ := strings.Cut(d, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "no-transaction":
+		h.noTransaction = true
+	case "schema":
+		err := validateIdentifier(arg)
+		if err != nil {
+			return fmt.Errorf("gograte:schema header: %w", err)
+		}
+		h.schema = arg
+	case "tags":
+		for _, tag := range strings.Split(arg, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				h.tags = append(h.tags, tag)
+			}
+		}
+	}
+	return nil
+}
+
+// hasTag reports whether the file is tagged with tag
+func (h fileHeaders) hasTag(tag string) bool {
+	for _, t := range h.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package gograte
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadHeadersLongFirstLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "001-bulk.sql")
+	sql := "insert into t values " + strings.Repeat("(1),", 100000) + "(1);\n"
+	err := os.WriteFile(path, []byte(sql), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := readHeaders(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.noTransaction || h.author != "" || len(h.tags) != 0 {
+		t.Errorf("headers = %+v, want none", h)
+	}
+}
+
+func TestReadHeadersBeforeLongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "001-bulk.sql")
+	sql := "-- author: jane\n-- gograte:no-transaction\n" + strings.Repeat("-", 100000) + "\n"
+	err := os.WriteFile(path, []byte(sql), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := readHeaders(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.author != "jane" || !h.noTransaction {
+		t.Errorf("headers = %+v, want author jane and no-transaction", h)
+	}
+}
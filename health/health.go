@@ -0,0 +1,55 @@
+// Package health provides an HTTP handler reporting gograte migration
+// status, suitable for mounting at a /migrations endpoint.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gilcrest/gograte"
+)
+
+// response is the JSON body written by the handler
+type response struct {
+	Profile        string    `json:"profile"`
+	CurrentVersion int       `json:"currentVersion"`
+	PendingCount   int       `json:"pendingCount"`
+	Pending        []pending `json:"pending,omitempty"`
+	PSQLVersion    string    `json:"psqlVersion,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// pending describes a migration file which has not been applied
+type pending struct {
+	Filename string `json:"filename"`
+	Author   string `json:"author,omitempty"`
+	Ticket   string `json:"ticket,omitempty"`
+}
+
+// Handler returns an http.Handler which reports the current schema
+// version and pending migrations for the given profile as JSON.
+// If the status cannot be determined, a 500 is returned with the
+// error in the body.
+func Handler(profile string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := response{Profile: profile}
+
+		status := http.StatusOK
+		s, err := gograte.Status(profile)
+		if err != nil {
+			status = http.StatusInternalServerError
+			resp.Error = err.Error()
+		} else {
+			resp.CurrentVersion = s.CurrentVersion
+			resp.PendingCount = len(s.Pending)
+			resp.PSQLVersion = s.PSQLVersion
+			for _, mf := range s.Pending {
+				resp.Pending = append(resp.Pending, pending{Filename: mf.Filename, Author: mf.Author, Ticket: mf.Ticket})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
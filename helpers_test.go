@@ -0,0 +1,248 @@
+package gograte
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePSQLScript stands in for psql in tests. Each invocation's args
+// are appended, one per line after a "--- call" line, to $FAKEPSQL_LOG.
+// It answers the queries gograte makes before running files, and any
+// -c statement containing a pattern in $FAKEPSQL_ANSWERS (see
+// answerQueries). Given -f -, it reads a script from stdin, appending
+// each line to $FAKEPSQL_LOG.stdin, and prints the text of each \echo.
+//
+// When $FAKEPSQL_FAIL is set, it fails like psql with ON_ERROR_STOP at
+// the first -f file whose path contains it: the args after that file
+// are not logged, as psql would not run them. Similarly, it hangs at
+// the first -f file whose path contains $FAKEPSQL_HANG, logging
+// "hanging", until it is sent SIGTERM, which it logs.
+const fakePSQLScript = `#!/bin/sh
+if [ "$1" = "--version" ]; then
+	echo "psql (PostgreSQL) 16.2"
+	exit 0
+fi
+log=${FAKEPSQL_LOG:-/dev/null}
+echo "--- call" >> "$log"
+env | grep '^PGAPPNAME=' >> "$log"
+prev=""
+for a in "$@"; do
+	echo "$a" >> "$log"
+	if [ "$prev" = "-c" ]; then
+		case "$a" in
+		"select current_database()") echo "$FAKEPSQL_DB" ;;
+		"select current_database(), current_user, version()") echo "$FAKEPSQL_DB|user|PostgreSQL 16.2" ;;
+		esac
+	fi
+	if [ "$prev" = "-c" ] && [ -n "$FAKEPSQL_ANSWERS" ]; then
+		while IFS='	' read -r pattern answer; do
+			case "$a" in
+			*"$pattern"*)
+				printf '%b\n' "$answer"
+				break
+				;;
+			esac
+		done < "$FAKEPSQL_ANSWERS"
+	fi
+	if [ "$prev" = "-f" ] && [ "$a" = "-" ]; then
+		while IFS= read -r line; do
+			echo "$line" >> "$log.stdin"
+			case "$line" in
+			"\\echo "*) echo "${line#?echo }" ;;
+			esac
+		done
+	fi
+	if [ "$prev" = "-f" ] && [ -n "$FAKEPSQL_HANG" ]; then
+		case "$a" in
+		*"$FAKEPSQL_HANG"*)
+			trap 'kill $pid; echo SIGTERM >> "$log"; exit 143' TERM
+			echo hanging >> "$log"
+			sleep 10 &
+			pid=$!
+			wait $pid
+			exit 1
+			;;
+		esac
+	fi
+	if [ "$prev" = "-f" ] && [ -n "$FAKEPSQL_FAIL" ]; then
+		case "$a" in
+		*"$FAKEPSQL_FAIL"*)
+			echo "psql:$a:1: ERROR:  syntax error at or near \"boom\"" >&2
+			exit 3
+			;;
+		esac
+	fi
+	prev=$a
+done
+exit 0
+`
+
+// installFakePSQL puts fakePSQLScript first on PATH and returns the
+// path of its log
+func installFakePSQL(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "psql"), []byte(fakePSQLScript), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	log := filepath.Join(dir, "psql.log")
+	t.Setenv("FAKEPSQL_LOG", log)
+	t.Setenv("FAKEPSQL_DB", "app")
+	t.Setenv("FAKEPSQL_FAIL", "")
+	t.Setenv("FAKEPSQL_ANSWERS", "")
+	t.Setenv("FAKEPSQL_HANG", "")
+	return log
+}
+
+// answerQueries makes the fake psql answer each -c statement containing
+// one of the patterns with its answer, in which \n separates rows and
+// | columns. Patterns are tried in the order given.
+func answerQueries(t *testing.T, answers ...[2]string) {
+	t.Helper()
+	var b strings.Builder
+	for _, a := range answers {
+		b.WriteString(a[0] + "\t" + a[1] + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "answers")
+	err := os.WriteFile(path, []byte(b.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKEPSQL_ANSWERS", path)
+}
+
+// psqlCalls returns the args of each fake psql invocation logged to log
+func psqlCalls(t *testing.T, log string) [][]string {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		if line == "--- call" {
+			calls = append(calls, []string{})
+			continue
+		}
+		calls[len(calls)-1] = append(calls[len(calls)-1], line)
+	}
+	return calls
+}
+
+// testProfile is the profile name newTestProject writes config for
+const testProfile = "test"
+
+// newTestProject writes the config for testProfile to a temporary
+// project, after fn has adjusted it, and points GOGRATE_CONFIG_DIR at
+// it. Migration files are read from the up and down directories of
+// the returned scripts directory, which exist but are empty.
+func newTestProject(t *testing.T, fn func(f *ConfigFile)) string {
+	t.Helper()
+	root := t.TempDir()
+	scriptsDir := filepath.Join(root, "migrations")
+	for _, dir := range []string{"config", "migrations/up", "migrations/down"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var f ConfigFile
+	f.Config.MigrationScriptsDir = scriptsDir
+	f.Config.AllowAbsoluteScriptsDir = true
+	db := &f.Config.Database
+	db.Host = "localhost"
+	db.Port = 5432
+	db.Name = "app"
+	db.User = "migrator"
+	db.Password = "secret"
+	db.SearchPath = "public"
+	if fn != nil {
+		fn(&f)
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(root, "config", testProfile+".json"), b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOGRATE_CONFIG_DIR", filepath.Join(root, "config"))
+	t.Setenv(databaseURLEnv, "")
+	t.Setenv(expectedHashEnv, "")
+
+	return scriptsDir
+}
+
+// writeFiles creates a file in dir for each name, holding a trivial
+// statement
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(dir, name), []byte("select 1;\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// indexOf returns the index of the first run of args matching want,
+// or -1
+func indexOf(args []string, want ...string) int {
+	for i := 0; i+len(want) <= len(args); i++ {
+		match := true
+		for j, w := range want {
+			if args[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// fileArgsOrder returns the base names of the files passed with -f,
+// in order
+func fileArgsOrder(args []string) []string {
+	var names []string
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-f" {
+			names = append(names, filepath.Base(args[i+1]))
+		}
+	}
+	return names
+}
+
+// emptyTempDir points TMPDIR at a new directory and returns it, so
+// leftover temporary directories can be found
+func emptyTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	return dir
+}
+
+// assertNoLeftovers fails t for each entry left in tmp
+func assertNoLeftovers(t *testing.T, tmp string) {
+	t.Helper()
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("temporary directory was not removed: %s", e.Name())
+	}
+}
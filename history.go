@@ -0,0 +1,178 @@
+package gograte
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// StatusApplied is the status of a migration which was applied successfully
+	StatusApplied = "applied"
+	// StatusDirty is the status of a migration which failed part way through
+	StatusDirty = "dirty"
+)
+
+// MigrationRecord is a row of the tracking table
+type MigrationRecord struct {
+	FileNumber int
+	Filename   string
+	// Batch is the number of the up run which applied the file
+	Batch     int
+	AppliedAt time.Time
+	// Status is StatusApplied or StatusDirty
+	Status string
+}
+
+// History returns every migration recorded in the tracking table,
+// ordered by the time it was applied. It is read only.
+func (t Tracker) History() ([]MigrationRecord, error) {
+	ok, err := t.Exists()
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var rows [][]string
+	rows, err = queryPSQL(t.DSN, fmt.Sprintf(`select file_number, filename, batch, to_char(applied_at at time zone 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'), dirty from %s order by applied_at, file_number`, t.table()))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]MigrationRecord, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != 5 {
+			return nil, fmt.Errorf("unexpected row reading history from %s: %v", t.table(), row)
+		}
+		r := MigrationRecord{Filename: row[1], Status: StatusApplied}
+		r.FileNumber, err = strconv.Atoi(row[0])
+		if err != nil {
+			return nil, err
+		}
+		r.Batch, err = strconv.Atoi(row[2])
+		if err != nil {
+			return nil, err
+		}
+		r.AppliedAt, err = time.Parse(time.RFC3339Nano, row[3])
+		if err != nil {
+			return nil, err
+		}
+		if row[4] == "t" {
+			r.Status = StatusDirty
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// LastApplied returns the time the most recently applied migration
+// in the tracking table was applied, or the zero time if none has
+// been.
+func (t Tracker) LastApplied() (time.Time, error) {
+	ok, err := t.Exists()
+	if err != nil || !ok {
+		return time.Time{}, err
+	}
+
+	var rows [][]string
+	rows, err = queryPSQL(t.DSN, fmt.Sprintf(`select coalesce(to_char(max(applied_at) at time zone 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'), '') from %s where not dirty`, t.table()))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(rows) == 0 || rows[0][0] == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, rows[0][0])
+}
+
+// History returns every migration recorded in the default tracking
+// table for the given connection, ordered by the time it was applied.
+func History(dsn PostgreSQLDSN) ([]MigrationRecord, error) {
+	return Tracker{DSN: dsn}.History()
+}
+
+// LoadTracker returns the Tracker for the given profile's tracking
+// table, for read only use. It connects to the read replica, if one is
+// configured. No SSH tunnel is opened, as the Tracker outlives the
+// call, so use Status for a profile which needs one.
+func LoadTracker(profile string, opts ...Option) (Tracker, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return Tracker{}, err
+	}
+
+	var t Tracker
+	t, err = NewTracker(f)
+	if err != nil {
+		return Tracker{}, err
+	}
+	t.DSN = newReplicaDSN(f)
+
+	return t, nil
+}
+
+// Orphans returns the migrations recorded in the given profile's
+// tracking table whose file number has no file in the up directory,
+// e.g. because the file was deleted after it was applied. Such a
+// database has objects without a source of truth on disk. The records
+// are read from the read replica, if one is configured.
+func Orphans(profile string, opts ...Option) ([]MigrationRecord, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return nil, err
+	}
+	err = requireTrackingTable(f, profile, "finding orphans")
+	if err != nil {
+		return nil, err
+	}
+
+	var t Tracker
+	t, err = NewTracker(f)
+	if err != nil {
+		return nil, err
+	}
+	var closeTunnel func()
+	t.DSN, closeTunnel, err = tunnelDSN(replicaConfig(f))
+	if err != nil {
+		return nil, err
+	}
+	defer closeTunnel()
+
+	var (
+		dir     string
+		cleanup func()
+	)
+	dir, cleanup, err = migrationDir(f, true)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(true))
+	if err != nil {
+		return nil, err
+	}
+	onDisk := make(map[int]bool, len(ddlFiles))
+	for _, df := range ddlFiles {
+		onDisk[df.fileNumber] = true
+	}
+
+	var records []MigrationRecord
+	records, err = t.History()
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []MigrationRecord
+	for _, r := range records {
+		if !onDisk[r.FileNumber] {
+			orphans = append(orphans, r)
+		}
+	}
+
+	return orphans, nil
+}
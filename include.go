@@ -0,0 +1,83 @@
+package gograte
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IncludeScript returns the master script run for the given direction
+// and profile when psql.includeScript is set: the same statements and
+// files as PSQLArgs, with each file included with a \i meta-command in
+// order instead of passed as a -f flag. The connection flags are not
+// part of the script.
+func IncludeScript(up bool, profile string, opts ...Option) (string, error) {
+	m, err := newMigration(up, profile, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer m.close()
+	return m.includeScript()
+}
+
+// includeScript converts the args which follow the connection flags
+// into a psql script
+func (m migration) includeScript() (string, error) {
+	args := m.args()[len(m.connArgs()):]
+
+	var b strings.Builder
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return "", fmt.Errorf("flag %s has no value", args[i])
+		}
+		flag, v := args[i], args[i+1]
+		switch flag {
+		case "-c":
+			b.WriteString(strings.TrimSuffix(v, ";") + ";\n")
+		case "-f":
+			path, err := filepath.Abs(v)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(`\i ` + quoteLiteral(path) + "\n")
+		case "-v":
+			name, value, _ := strings.Cut(v, "=")
+			b.WriteString(`\set ` + name + " " + value + "\n")
+		default:
+			return "", fmt.Errorf("flag %s cannot be written to an include script", flag)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// runIncludeScript writes the master script to a temporary file and
+// runs it with a single -f flag, which keeps the command line short
+// however many files there are. The script is removed afterward.
+func (m migration) runIncludeScript(ctx context.Context) error {
+	script, err := m.includeScript()
+	if err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	tmp, err = os.CreateTemp("", "gograte-*.sql")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(script)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return runPSQLContext(ctx, m.dsn, append(m.connArgs(), "-f", tmp.Name()))
+}
@@ -0,0 +1,52 @@
+package gograte
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeScriptListsFilesInOrder(t *testing.T) {
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.IncludeScript = true
+	})
+	writeFiles(t, scriptsDir+"/up", "010-c.sql", "001-a.sql", "002-b.sql")
+
+	script, err := IncludeScript(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var includes []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(line, `\i `) {
+			includes = append(includes, line)
+		}
+	}
+	var want []string
+	for _, name := range []string{"001-a.sql", "002-b.sql", "010-c.sql"} {
+		want = append(want, `\i `+quoteLiteral(filepath.Join(scriptsDir, "up", name)))
+	}
+	if strings.Join(includes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("includes:\n%s\nwant:\n%s", strings.Join(includes, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunIncludeScript(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.IncludeScript = true
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+	tmp := emptyTempDir(t)
+
+	err := Run(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := psqlCalls(t, log)
+	files := fileArgsOrder(calls[len(calls)-1])
+	if len(files) != 1 || !strings.HasPrefix(files[0], "gograte-") {
+		t.Fatalf("psql was not run with a single master script: %q", files)
+	}
+	assertNoLeftovers(t, tmp)
+}
@@ -0,0 +1,50 @@
+package gograte
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SubdirLayout is the default layout where up and down files
+	// are in up and down directories, e.g. up/001-user.sql
+	SubdirLayout = "subdirs"
+	// SuffixLayout is the layout where up and down files share a
+	// directory and are told apart by suffix, e.g. 001-user.up.sql
+	// and 001-user.down.sql
+	SuffixLayout = "suffix"
+)
+
+// file suffixes of the SuffixLayout
+const (
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+)
+
+// fileSuffix returns the suffix of files for the given direction in
+// the suffix layout, or "" for the subdirs layout
+func (f ConfigFile) fileSuffix(up bool) string {
+	switch {
+	case f.Config.Layout != SuffixLayout:
+		return ""
+	case up:
+		return upSuffix
+	default:
+		return downSuffix
+	}
+}
+
+// otherDirection reports whether name is a file for the direction
+// other than the one with suffix. A .sql file with neither the up nor
+// the down suffix is an error, as its direction is unknown.
+func otherDirection(name, suffix string) (bool, error) {
+	switch {
+	case strings.HasSuffix(name, suffix):
+		return false, nil
+	case strings.HasSuffix(name, upSuffix) || strings.HasSuffix(name, downSuffix):
+		return true, nil
+	case strings.HasSuffix(name, ".sql"):
+		return false, fmt.Errorf("%s has neither a %s nor a %s suffix", name, upSuffix, downSuffix)
+	}
+	return false, nil
+}
@@ -0,0 +1,119 @@
+package gograte
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newSuffixProject returns the scripts directory of a test project
+// using the suffix layout
+func newSuffixProject(t *testing.T) string {
+	t.Helper()
+	return newTestProject(t, func(f *ConfigFile) {
+		f.Config.Layout = SuffixLayout
+	})
+}
+
+func TestArgsSuffixLayout(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newSuffixProject(t)
+	writeFiles(t, scriptsDir,
+		"001-user.up.sql", "001-user.down.sql",
+		"002-org.up.sql", "002-org.down.sql")
+
+	tests := []struct {
+		up   bool
+		want []string
+	}{
+		{up: true, want: []string{"001-user.up.sql", "002-org.up.sql"}},
+		{up: false, want: []string{"002-org.down.sql", "001-user.down.sql"}},
+	}
+	for _, tt := range tests {
+		args, err := PSQLArgs(tt.up, testProfile)
+		if err != nil {
+			t.Fatalf("up=%t: %v", tt.up, err)
+		}
+		if got := fileArgsOrder(args); !slices.Equal(got, tt.want) {
+			t.Errorf("up=%t: files = %q, want %q", tt.up, got, tt.want)
+		}
+	}
+}
+
+func TestSuffixLayoutUnknownDirection(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newSuffixProject(t)
+	writeFiles(t, scriptsDir, "001-user.up.sql", "002-org.sql")
+
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil || !strings.Contains(err.Error(), "002-org.sql has neither") {
+		t.Errorf("PSQLArgs error = %v, want one naming 002-org.sql", err)
+	}
+}
+
+func TestSuffixLayoutIsOptIn(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir, "001-user.up.sql")
+	writeFiles(t, scriptsDir+"/up", "001-user.sql")
+
+	args, err := PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fileArgsOrder(args); !slices.Equal(got, []string{"001-user.sql"}) {
+		t.Errorf("files = %q, want the up directory's", got)
+	}
+}
+
+func TestSuffixLayoutEnsurePaired(t *testing.T) {
+	scriptsDir := newSuffixProject(t)
+	writeFiles(t, scriptsDir, "001-user.up.sql", "001-user.down.sql", "002-org.up.sql")
+
+	err := EnsurePaired(testProfile)
+	if err == nil || !strings.Contains(err.Error(), "002-org.up.sql has no down file") {
+		t.Errorf("EnsurePaired error = %v, want 002-org.up.sql reported", err)
+	}
+
+	writeFiles(t, scriptsDir, "002-org.down.sql")
+	err = EnsurePaired(testProfile)
+	if err != nil {
+		t.Errorf("EnsurePaired: %v", err)
+	}
+}
+
+func TestSuffixLayoutNewMigrationFiles(t *testing.T) {
+	scriptsDir := newSuffixProject(t)
+	writeFiles(t, scriptsDir, "001-user.up.sql", "001-user.down.sql")
+
+	upPath, downPath, err := NewMigrationFiles(testProfile, "add_org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(scriptsDir, "002-add_org.up.sql"); upPath != want {
+		t.Errorf("upPath = %q, want %q", upPath, want)
+	}
+	if want := filepath.Join(scriptsDir, "002-add_org.down.sql"); downPath != want {
+		t.Errorf("downPath = %q, want %q", downPath, want)
+	}
+	for _, p := range []string{upPath, downPath} {
+		_, err = os.Stat(p)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSuffixLayoutRejectsDownScriptsDir(t *testing.T) {
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.Layout = SuffixLayout
+		f.Config.DownScriptsDir = t.TempDir()
+	})
+
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil || !strings.Contains(err.Error(), "downScriptsDir cannot be used") {
+		t.Errorf("PSQLArgs error = %v, want downScriptsDir rejected", err)
+	}
+}
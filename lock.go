@@ -0,0 +1,118 @@
+package gograte
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+// advisoryLockHeld is echoed by the lock session once it holds the lock
+const advisoryLockHeld = "gograte: advisory lock held"
+
+// advisoryLockKey returns the key of the advisory lock taken before a
+// migration runs: the configured key or, by default, the FNV-1a 64 bit
+// hash of the database name, read as a signed bigint. When a component
+// is configured, "/" and the component name are hashed after the
+// database name. Scoping the key to the database (and component) keeps
+// independent databases on the same cluster from blocking each other.
+//
+// In pg_locks the lock shows with locktype advisory, objsubid 1, the
+// high 32 bits of the key as classid and the low 32 bits as objid.
+func (f ConfigFile) advisoryLockKey() int64 {
+	if f.Config.AdvisoryLock.Key != 0 {
+		return f.Config.AdvisoryLock.Key
+	}
+	h := fnv.New64a()
+	h.Write([]byte(f.Config.Database.Name))
+	if f.Config.Component != "" {
+		h.Write([]byte("/" + f.Config.Component))
+	}
+	return int64(h.Sum64())
+}
+
+// advisoryLockSQL returns the statement which takes the advisory lock,
+// waiting for any other migration holding it to finish. The lock is
+// held for the psql session and released when psql exits.
+func (f ConfigFile) advisoryLockSQL() string {
+	return fmt.Sprintf("select pg_advisory_lock(%d)", f.advisoryLockKey())
+}
+
+// holdAdvisoryLock takes the advisory lock in a psql session of its own
+// and returns a func which releases it and ends the session. It is
+// used by the runners which invoke psql once per file, as a lock taken
+// in one of those invocations is released when it exits. Without
+// advisoryLock enabled, nothing is done.
+func (m migration) holdAdvisoryLock(ctx context.Context) (func() error, error) {
+	if !m.config.Config.AdvisoryLock.Enabled {
+		return func() error { return nil }, nil
+	}
+
+	cmd := psqlCommand(ctx, m.dsn, append(m.connArgs(), "-X", "-q", "-A", "-t", "-v", "ON_ERROR_STOP=1", "-f", "-"))
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stdout io.ReadCloser
+	stdout, err = cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	// psql exits, closing stdout, if the lock cannot be taken
+	_, err = fmt.Fprintf(stdin, "%s;\n\\echo %s\n", m.config.advisoryLockSQL(), advisoryLockHeld)
+	held := false
+	s := bufio.NewScanner(stdout)
+	for err == nil && s.Scan() {
+		if s.Text() == advisoryLockHeld {
+			held = true
+			break
+		}
+	}
+	if !held {
+		stdin.Close()
+		_, _ = io.Copy(io.Discard, stdout)
+		err = errors.Join(err, cmd.Wait())
+		if err == nil {
+			err = errors.New("psql exited")
+		}
+		return nil, fmt.Errorf("take advisory lock: %w", err)
+	}
+
+	// all output must be read before calling Wait, which closes the pipes
+	drained := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, stdout)
+		close(drained)
+	}()
+
+	return func() error {
+		_, err := fmt.Fprintf(stdin, "select pg_advisory_unlock(%d);\n", m.config.advisoryLockKey())
+		stdin.Close()
+		<-drained
+		err = errors.Join(err, cmd.Wait())
+		if err != nil {
+			return fmt.Errorf("release advisory lock: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// AdvisoryLockKey returns the advisory lock key used for the given
+// profile, so operators can find a running migration in pg_locks.
+func AdvisoryLockKey(profile string, opts ...Option) (int64, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return 0, err
+	}
+	return f.advisoryLockKey(), nil
+}
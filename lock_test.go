@@ -0,0 +1,51 @@
+package gograte
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestManifestRunHoldsAdvisoryLock(t *testing.T) {
+	log := installFakePSQL(t)
+	var key int64
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.Tracking.Manifest = "default"
+		f.Config.AdvisoryLock.Enabled = true
+		key = f.advisoryLockKey()
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+
+	err := Run(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := psqlCalls(t, log)
+	if len(calls) == 0 || indexOf(calls[0], "-f", "-") == -1 {
+		t.Fatalf("the lock session is not started before the files run: %q", calls)
+	}
+	if got := fileArgsOrder(calls[0]); len(got) != 1 || got[0] != "-" {
+		t.Errorf("the lock session ran files: %q", got)
+	}
+	var ran int
+	for _, call := range calls[1:] {
+		ran += len(fileArgsOrder(call))
+	}
+	if ran != 2 {
+		t.Errorf("ran %d files, want 2", ran)
+	}
+
+	b, err := os.ReadFile(log + ".stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := strconv.FormatInt(key, 10)
+	lock := strings.Index(string(b), "select pg_advisory_lock("+k+");")
+	unlock := strings.Index(string(b), "select pg_advisory_unlock("+k+");")
+	if lock == -1 || unlock < lock {
+		t.Errorf("the lock session did not take and release the lock:\n%s", b)
+	}
+}
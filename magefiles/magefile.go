@@ -1,6 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
 	"github.com/gilcrest/gograte"
 	"github.com/magefile/mage/sh"
 )
@@ -19,9 +29,20 @@ import (
 // The files are run through cue vet to ensure they are acceptable given
 // the schema found in schema.cue and are then run through cue "fmt" to
 // format the files.
+//
+// The json file is written to ./config unless the GOGRATE_CONFIG_DIR
+// environment variable names another directory (e.g. a gitignored
+// build directory). The up and down targets read config from the
+// same directory.
 func CueGenConfig(profile string) (err error) {
 
-	paths := gograte.CUEPaths(profile)
+	outputDir := gograte.ConfigDir()
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	paths := gograte.CUEPaths(profile, outputDir)
 
 	// Vet input files
 	vetArgs := []string{"vet"}
@@ -52,51 +73,622 @@ func CueGenConfig(profile string) (err error) {
 	return nil
 }
 
+// CueGenAll generates the JSON config for every profile with a .cue file in
+// ./config/cue, example: mage -v cueGenAll.
+//
+// Every profile is attempted and the result of each is printed. Failures
+// are reported together at the end.
+func CueGenAll() error {
+	profiles, err := gograte.ListProfiles()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, profile := range profiles {
+		err = CueGenConfig(profile)
+		if err != nil {
+			fmt.Printf("%s: failed\n", profile)
+			errs = append(errs, fmt.Errorf("%s: %w", profile, err))
+			continue
+		}
+		fmt.Printf("%s: ok\n", profile)
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateConfig checks the JSON config for a profile against schema.cue,
+// example: mage -v validateConfig default.
+func ValidateConfig(profile string) error {
+	return gograte.ValidateConfigCUE(profile)
+}
+
 // Up uses the psql cli to execute DDL scripts found in the up directory, example: mage -v up default.
 //
 // A json file matching the profile name is expected in the ./config directory.
+// The database password is passed to psql in the PGPASSWORD environment variable.
 // A default.json file is provided, but others may be generated easily (or just copy/paste).
 //
-// All files will be executed, regardless of errors within an individual file.
-// Check output to determine if any errors occurred. Eventually, I will write
-// this to stop on errors, but for now it is what it is.
+// When tracking or psql.singleTransaction is enabled, psql runs with
+// ON_ERROR_STOP, so execution stops at the first failed statement and an
+// error is returned. With singleTransaction, nothing is committed.
+// Otherwise psql continues past failed statements and only reports
+// them in its output, use upCollectErrors to have every failure
+// returned instead.
+//
+// If tracking is enabled in the config, only files which are not yet
+// recorded in the tracking table are run.
 func Up(profile string) (err error) {
-	var args []string
+	// Ctrl-C stops psql, rolling back its open transaction
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	args, err = gograte.PSQLArgs(true, profile)
+	err = gograte.RunContext(ctx, true, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	err = sh.Run("psql", args...)
-	if err != nil {
-		return err
+	return nil
+}
+
+// GenAndUp regenerates the JSON config from CUE and then runs the up migration,
+// example: mage -v genAndUp default false false.
+//
+// It is the same as running cueGenConfig followed by up, failing fast if
+// generation fails so migrations always run against freshly generated config.
+// Either phase can be skipped with skipGen or skipUp.
+func GenAndUp(profile string, skipGen, skipUp bool) (err error) {
+	if !skipGen {
+		err = CueGenConfig(profile)
+		if err != nil {
+			return fmt.Errorf("generate config: %w", err)
+		}
+	}
+
+	if !skipUp {
+		err = Up(profile)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// UpProgress runs the up migration one file at a time, printing progress after
+// each file, example: mage -v upProgress default.
+//
+// Execution stops on the first failed file.
+func UpProgress(profile string) error {
+	err := gograte.RunWithProgress(true, profile, func(done, total int) {
+		fmt.Printf("applied %d of %d files (%d%%)\n", done, total, done*100/total)
+	})
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	return err
+}
+
+// UpTimed runs the up migration one file at a time and prints how long each
+// file took and the slowest file, example: mage -v upTimed default.
+//
+// Set GOGRATE_REPORT to a path to also write the report as JSON.
+func UpTimed(profile string) error {
+	r, err := gograte.RunTimed(true, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	if r.Connection.Database != "" {
+		fmt.Printf("connected to %s as %s (%s)\n", r.Connection.Database, r.Connection.User, r.Connection.Version)
+	}
+	for _, res := range r.Results {
+		fmt.Printf("%s  %s\n", res.Filename, res.Duration.Round(time.Millisecond))
+	}
+	fmt.Println(r.Summary())
+	if path := os.Getenv("GOGRATE_REPORT"); path != "" {
+		b, jsonErr := json.MarshalIndent(r, "", "  ")
+		if jsonErr != nil {
+			return errors.Join(err, jsonErr)
+		}
+		if writeErr := os.WriteFile(path, b, 0644); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+	}
+	return err
+}
+
 // Down uses the psql cli to execute drop statement DDL scripts
 // found in the down directory, example: mage -v down default.
 //
 // A json file matching the profile name is expected in the ./config directory.
 // A default.json file is provided, but others may be generated easily (or just copy/paste).
 //
-// All files will be executed, regardless of errors within an individual file.
-// Check output to determine if any errors occurred. Eventually, I will write
-// this to stop on errors, but for now it is what it is.
+// When tracking or psql.singleTransaction is enabled, psql runs with
+// ON_ERROR_STOP, so execution stops at the first failed statement and an
+// error is returned. With singleTransaction, nothing is committed.
+// Otherwise psql continues past failed statements and only reports
+// them in its output.
+//
+// Files run in descending file number order, newest first.
+//
+// If tracking is enabled in the config, only files recorded as applied
+// in the tracking table are run.
 func Down(profile string) (err error) {
-	var args []string
+	// Ctrl-C stops psql, rolling back its open transaction
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = gograte.RunContext(ctx, false, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Verify checks the DDL files for the given profile, example: mage -v verify default.
+//
+// Up and down files must be paired by file number and neither directory
+// may contain duplicate file numbers or gaps in the numbering sequence.
+// File number padding warnings are printed, but only fail the check
+// when strictFileNumberWidth is set in the config.
+func Verify(profile string) error {
+	warnings, err := gograte.Verify(profile)
+	for _, w := range warnings {
+		fmt.Println("warning:", w)
+	}
+	return err
+}
+
+// Plan prints the files the up migration would run as a tree, in order and
+// grouped by transaction, example: mage -v plan default.
+//
+// Each up file is first listed as applied, pending or MODIFIED, an applied file
+// whose checksum has changed since it ran.
+//
+// Nothing is executed.
+func Plan(profile string) error {
+	previews, err := gograte.Preview(profile)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATE\tCHECKSUM")
+	for _, fp := range previews {
+		state := fp.State
+		if state == gograte.FileModified {
+			state = "MODIFIED (applied " + shortChecksum(fp.AppliedChecksum) + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", fp.Filename, state, shortChecksum(fp.Checksum))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	var p gograte.ExecutionPlan
+	p, err = gograte.Plan(true, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(p.Tree())
+	return nil
+}
 
-	args, err = gograte.PSQLArgs(false, profile)
+// PlanVerbose lists each file the up migration would run with its full path,
+// size in bytes and modification time, example: mage -v planVerbose default.
+//
+// Nothing is executed.
+func PlanVerbose(profile string) error {
+	infos, err := gograte.ListMigrations(true, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tSIZE\tMODIFIED")
+	for _, mfi := range infos {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", mfi.AbsPath, mfi.Size, mfi.ModTime.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
 
-	err = sh.Run("psql", args...)
+// shortChecksum abbreviates a checksum for display
+func shortChecksum(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+// DownRange prints the down files numbered from through to combined into one
+// script in rollback order, for review, example: mage -v downRange default 5 8.
+//
+// Nothing is executed.
+func DownRange(profile string, from, to int) error {
+	script, err := gograte.DownRangeScript(profile, from, to)
 	if err != nil {
 		return err
 	}
+	fmt.Print(script)
+	return nil
+}
 
+// DownPreview prints the down files a down migration would run, in the order
+// they would run, example: mage -v downPreview default.
+//
+// Nothing is executed.
+func DownPreview(profile string) error {
+	files, err := gograte.DownPreview(profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i, mf := range files {
+		fmt.Printf("%d. %s\n", i+1, mf.Path)
+	}
+	return nil
+}
+
+// Impact prints a heuristic summary of what each pending up file does, counts
+// of CREATE, ALTER and DROP statements and whether indexes or constraints are
+// touched, followed by the total, example: mage -v impact default.
+//
+// Nothing is executed.
+func Impact(profile string) error {
+	total, files, err := gograte.AnalyzeMigrations(true, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range files {
+		fmt.Println(s)
+	}
+	fmt.Println(total)
+	return nil
+}
+
+// CompareProfiles reports files present in one profile's migration directories
+// but not the other's, example: mage -v compareProfiles staging prod.
+func CompareProfiles(profileA, profileB string) error {
+	return gograte.CompareProfiles(profileA, profileB)
+}
+
+// PendingHash prints the hash of the pending up migrations, the value to approve
+// and pass to upExpectHash, example: mage -v pendingHash default.
+func PendingHash(profile string) error {
+	hash, err := gograte.PendingSetHash(true, profile)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// UpExpectHash runs the up migration only if the hash of the pending files matches
+// the reviewed hash, example: mage -v upExpectHash default 3f2a...
+//
+// Setting GOGRATE_EXPECTED_HASH gates the up target the same way.
+func UpExpectHash(profile, hash string) error {
+	err := gograte.Run(true, profile, gograte.WithExpectedHash(hash))
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	return err
+}
+
+// Env prints the connection for a profile as libpq environment variables,
+// example: eval $(mage env default).
+//
+// The output includes the password.
+func Env(profile string) error {
+	dsn, err := gograte.BuildDSN(profile)
+	if err != nil {
+		return err
+	}
+	for _, line := range dsn.EnvExports() {
+		fmt.Println("export " + line)
+	}
+	return nil
+}
+
+// Exec runs a single SQL command against the connection for a profile and
+// prints the output, example: mage -v exec default "select count(*) from users".
+//
+// Protected profiles require GOGRATE_CONFIRM_EXEC to be set to the profile name.
+func Exec(profile, sql string) error {
+	out, err := gograte.Exec(profile, sql)
+	os.Stdout.Write(out)
+	return err
+}
+
+// Preflight checks the connecting user holds the privileges the migration needs,
+// example: mage -v preflight default.
+func Preflight(profile string) error {
+	return gograte.PreflightPermissions(profile)
+}
+
+// UpTag runs the up migration for only the files tagged with tag in a
+// "-- gograte:tags" header comment, example: mage -v upTag default billing.
+func UpTag(profile, tag string) error {
+	err := gograte.Run(true, profile, gograte.WithTag(tag))
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	return err
+}
+
+// UpGlob runs the up migration for only the files whose name matches the glob
+// pattern, example: mage -v upGlob default "*-online-*.sql".
+func UpGlob(profile, pattern string) error {
+	err := gograte.Run(true, profile, gograte.WithGlob(pattern))
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	return err
+}
+
+// UpSince runs the up migration for files with a timestamp prefix after
+// the given cutoff, example: mage -v upSince default 2024-01-15.
+//
+// The config must use the timestamp naming scheme. The cutoff may be
+// given as RFC 3339, a date (2006-01-02) or a file prefix (20060102150405).
+func UpSince(profile, since string) (err error) {
+	var t time.Time
+
+	t, err = gograte.ParseSince(since)
+	if err != nil {
+		return err
+	}
+
+	err = gograte.Run(true, profile, gograte.WithSince(t))
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+
+	return err
+}
+
+// RollbackLast runs the down files for the migrations applied by the most
+// recent up run, example: mage -v rollbackLast default.
+//
+// Tracking must be enabled in the config. Files are rolled back in descending
+// order and execution stops on the first error.
+func RollbackLast(profile string) error {
+	return gograte.RollbackBatch(profile)
+}
+
+// Status prints the current schema version and the pending up migrations,
+// example: mage -v status default.
+//
+// Tracking must be enabled in the config for applied migrations to be known.
+func Status(profile string) error {
+	s, err := gograte.Status(profile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("psql version: %s\n", s.PSQLVersion)
+	fmt.Printf("current version: %d\n", s.CurrentVersion)
+	fmt.Printf("pending: %d\n", len(s.Pending))
+	for _, mf := range s.Pending {
+		fmt.Printf("  %s", mf.Filename)
+		if mf.Author != "" {
+			fmt.Printf("  author: %s", mf.Author)
+		}
+		if mf.Ticket != "" {
+			fmt.Printf("  ticket: %s", mf.Ticket)
+		}
+		if len(mf.Tags) > 0 {
+			fmt.Printf("  tags: %s", strings.Join(mf.Tags, ","))
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// DumpSchema writes the schema of the database for a profile to outPath using
+// pg_dump --schema-only, example: mage -v dumpSchema default schema.sql.
+func DumpSchema(profile, outPath string) error {
+	return gograte.DumpSchema(profile, outPath)
+}
+
+// CompareSchemas dumps the schemas of the databases for two profiles and prints
+// how they differ, example: mage -v compareSchemas staging prod.
+//
+// It fails if the schemas are not identical.
+func CompareSchemas(profileA, profileB string) error {
+	diff, identical, err := gograte.CompareSchemas(profileA, profileB)
+	if err != nil {
+		return err
+	}
+	if identical {
+		fmt.Printf("schemas of %s and %s are identical\n", profileA, profileB)
+		return nil
+	}
+	fmt.Print(diff)
+	return errors.New("schemas differ")
+}
+
+// TempDB runs the up migrations against a throwaway database created on the
+// server of a profile, then drops it, example: mage -v tempDB default.
+//
+// The user in the config needs the CREATEDB privilege.
+func TempDB(profile string) error {
+	return gograte.WithTempDB(profile, func(dsn gograte.PostgreSQLDSN) error {
+		fmt.Printf("migrated temporary database %s\n", dsn.DBName)
+		return nil
+	})
+}
+
+// Doctor checks the config, migration files, psql and database connection for
+// a profile and prints each check as PASS or FAIL, example: mage -v doctor default.
+//
+// Set GOGRATE_REPORT to a path to also write the report as JSON.
+func Doctor(profile string) error {
+	r := gograte.Doctor(profile)
+	fmt.Print(r)
+	if path := os.Getenv("GOGRATE_REPORT"); path != "" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+	}
+	if !r.Passed() {
+		return errors.New("doctor found problems")
+	}
+	return nil
+}
+
+// HasPending prints whether any up migrations have not been applied,
+// example: mage -v hasPending default.
+func HasPending(profile string) error {
+	pending, err := gograte.HasPending(profile)
+	if err != nil {
+		return err
+	}
+	fmt.Println(pending)
+	return nil
+}
+
+// Orphans lists migrations recorded as applied whose up file no longer exists,
+// example: mage -v orphans default.
+//
+// An error is returned when there are any, so the target can gate a pipeline.
+func Orphans(profile string) error {
+	orphans, err := gograte.Orphans(profile)
+	if err != nil {
+		return err
+	}
+	for _, r := range orphans {
+		fmt.Printf("%d\t%s\tbatch %d\n", r.FileNumber, r.Filename, r.Batch)
+	}
+	if len(orphans) > 0 {
+		return fmt.Errorf("%d applied migrations have no up file", len(orphans))
+	}
+	return nil
+}
+
+// RoundTrip applies each pending up file, runs its down file and re-runs the up
+// file, checking the schema is restored each time, example: mage -v roundTrip default.
+//
+// It is expensive and meant for CI against a disposable database.
+func RoundTrip(profile string) error {
+	err := gograte.RoundTrip(profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	return err
+}
+
+// UpCollectErrors runs each DDL file in the up directory in its own psql
+// invocation, example: mage -v upCollectErrors default.
+//
+// Unlike up, every file is run even if others fail and all failures are
+// reported at the end along with psql's error message for each file.
+func UpCollectErrors(profile string) error {
+	err := gograte.RunEachFile(true, profile)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	return err
+}
+
+// Resume re-runs the up file which failed in the previous run and then the
+// remaining pending files, example: mage -v resume default.
+//
+// Tracking must be enabled in the config. Fix the failed file before resuming.
+func Resume(profile string) error {
+	return gograte.Resume(profile)
+}
+
+// MarkApplied records the up files numbered 1 through upTo as applied without
+// running them, to adopt an existing database, example: mage -v markApplied default 12.
+//
+// Tracking must be enabled in the config. Files already recorded are skipped.
+func MarkApplied(profile string, upTo int) error {
+	marked, err := gograte.MarkApplied(profile, upTo)
+	if errors.Is(err, gograte.ErrNoMigrations) {
+		fmt.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, mf := range marked {
+		fmt.Println("marked applied:", mf.Filename)
+	}
+	return nil
+}
+
+// History prints every migration recorded in the tracking table, ordered by
+// the time it was applied, example: mage -v history default.
+func History(profile string) error {
+	t, err := gograte.LoadTracker(profile)
+	if err != nil {
+		return err
+	}
+
+	var records []gograte.MigrationRecord
+	records, err = t.History()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE NUMBER\tFILENAME\tBATCH\tAPPLIED AT\tSTATUS")
+	for _, r := range records {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", r.FileNumber, r.Filename, r.Batch, r.AppliedAt.Format(time.RFC3339), r.Status)
+	}
+
+	return w.Flush()
+}
+
+// New creates an empty up and down file pair for a new migration,
+// example: mage -v new default add_users.
+//
+// The file name follows the naming scheme in the config, e.g. for the
+// default sequence scheme the next number after the last up file is used.
+func New(profile, name string) error {
+	upPath, downPath, err := gograte.NewMigrationFiles(profile, name)
+	if err != nil {
+		return err
+	}
+	fmt.Println("created", upPath)
+	fmt.Println("created", downPath)
 	return nil
 }
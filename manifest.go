@@ -0,0 +1,167 @@
+package gograte
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultManifestFile is the name of the tracking manifest in
+// ConfigDir when tracking.manifest is "default"
+const defaultManifestFile = ".gograte-applied.json"
+
+// manifestEntry records an applied file in a tracking manifest
+type manifestEntry struct {
+	FileNumber int    `json:"fileNumber"`
+	Filename   string `json:"filename"`
+	// Checksum is the hex encoded SHA-256 of the up file when it
+	// was applied
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// trackingManifest is a file based alternative to the tracking table
+// for databases where gograte may not create one. It is only as
+// accurate as its file: changes made to the database without gograte,
+// or a manifest lost, reverted or shared between databases, are not
+// noticed, so it can drift from the actual database state.
+type trackingManifest struct {
+	Applied []manifestEntry `json:"applied"`
+}
+
+// manifestPath returns the path of the tracking manifest, or "" if
+// tracking uses the tracking table
+func (f ConfigFile) manifestPath() string {
+	t := f.Config.Tracking
+	dir := f.configDir
+	if dir == "" {
+		dir = ConfigDir()
+	}
+	switch {
+	case !t.Enabled || t.Manifest == "":
+		return ""
+	case t.Manifest == "default" && f.Config.Component != "":
+		return dir + "/.gograte-applied" + f.componentSuffix() + ".json"
+	case t.Manifest == "default":
+		return dir + "/" + defaultManifestFile
+	}
+	return t.Manifest
+}
+
+// readManifest reads the tracking manifest at path. A missing manifest
+// is empty.
+func readManifest(path string) (trackingManifest, error) {
+	var tm trackingManifest
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tm, nil
+	}
+	if err != nil {
+		return tm, err
+	}
+	err = json.Unmarshal(b, &tm)
+	if err != nil {
+		return tm, fmt.Errorf("%s: %w", path, err)
+	}
+	return tm, nil
+}
+
+// write replaces the manifest at path. The content is written to a
+// temporary file first so an interrupted write never truncates it.
+func (tm trackingManifest) write(path string) error {
+	if tm.Applied == nil {
+		tm.Applied = []manifestEntry{}
+	}
+	sort.Slice(tm.Applied, func(i, j int) bool {
+		return tm.Applied[i].FileNumber < tm.Applied[j].FileNumber
+	})
+	b, err := json.MarshalIndent(tm, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	tmp, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(b, '\n'))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// applied returns the set of file numbers in the manifest
+func (tm trackingManifest) applied() map[int]bool {
+	applied := make(map[int]bool, len(tm.Applied))
+	for _, e := range tm.Applied {
+		applied[e.FileNumber] = true
+	}
+	return applied
+}
+
+// record adds (up) or removes (down) the file at dir/df.filename
+func (tm *trackingManifest) record(df ddlFile, dir string, up bool) error {
+	var kept []manifestEntry
+	for _, e := range tm.Applied {
+		if e.FileNumber != df.fileNumber {
+			kept = append(kept, e)
+		}
+	}
+	tm.Applied = kept
+	if !up {
+		return nil
+	}
+
+	checksum, err := fileChecksum(dir + "/" + df.filename)
+	if err != nil {
+		return err
+	}
+	tm.Applied = append(tm.Applied, manifestEntry{
+		FileNumber: df.fileNumber,
+		Filename:   df.filename,
+		Checksum:   checksum,
+		AppliedAt:  time.Now().UTC(),
+	})
+	return nil
+}
+
+// recordManifest records df in the migration's tracking manifest once
+// it has run successfully. It does nothing when no manifest is used.
+func (m migration) recordManifest(df ddlFile) error {
+	if m.manifest == "" {
+		return nil
+	}
+	tm, err := readManifest(m.manifest)
+	if err != nil {
+		return err
+	}
+	err = tm.record(df, m.dir, m.up)
+	if err != nil {
+		return err
+	}
+	return tm.write(m.manifest)
+}
+
+// requireTrackingTable returns an error if the profile does not track
+// migrations in the tracking table, which what needs
+func requireTrackingTable(f ConfigFile, profile, what string) error {
+	if !f.Config.Tracking.Enabled {
+		return fmt.Errorf("%s requires tracking to be enabled for profile %q", what, profile)
+	}
+	if f.manifestPath() != "" {
+		return fmt.Errorf("%s requires the tracking table, profile %q tracks migrations in a manifest", what, profile)
+	}
+	return nil
+}
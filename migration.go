@@ -0,0 +1,519 @@
+package gograte
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diagnosticQuery is run before any files to show where psql connected
+const diagnosticQuery = "select current_database(), current_user, version()"
+
+// migration is the resolved set of DDL files to run in one direction
+// for a profile, along with everything needed to build psql args.
+type migration struct {
+	up      bool
+	profile string
+	config  ConfigFile
+	dsn     PostgreSQLDSN
+	// dir is the directory the files are read from
+	dir   string
+	files []ddlFile
+	// cleanup removes dir when it was extracted from an archive
+	cleanup func()
+	// closeTunnel closes the SSH tunnel opened for the migration
+	closeTunnel func()
+	// renderDir holds the rendered files once render has run, when
+	// templates are enabled
+	renderDir string
+	// tracker and batch are set when tracking is enabled
+	tracker Tracker
+	batch   int
+	// manifest is the path of the tracking manifest, when tracking
+	// uses one instead of the tracking table
+	manifest string
+	// connectionInfo, when set, is passed the result of the
+	// diagnostic query, which is then left out of args
+	connectionInfo func(ConnectionInfo)
+	// expectedHash, when set, must match the hash of files before
+	// they run, see checkExpectedHash
+	expectedHash string
+}
+
+// newMigration loads the config for profile, then reads, sorts and
+// filters the DDL files to run in the given direction. Up files run in
+// ascending and down files in descending file number order. The
+// caller must close the returned migration.
+func newMigration(up bool, profile string, opts ...Option) (_ migration, err error) {
+
+	var f ConfigFile
+
+	o := newOptions(opts)
+
+	// read JSON config file
+	f, err = loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return migration{}, err
+	}
+
+	err = validateExtraArgs(f.Config.PSQL.ExtraArgs)
+	if err != nil {
+		return migration{}, err
+	}
+
+	err = validatePasswordPrompt(f.Config.PSQL.PasswordPrompt)
+	if err != nil {
+		return migration{}, err
+	}
+
+	if f.Config.PSQL.FastUnsafe && f.Config.Protected {
+		return migration{}, fmt.Errorf("psql.fastUnsafe cannot be used with a protected profile")
+	}
+
+	err = checkPSQLVersion(f.Config.PSQL.MinVersion)
+	if err != nil {
+		return migration{}, err
+	}
+
+	err = f.applyConnectionOverride(o.connectionOverride)
+	if err != nil {
+		return migration{}, err
+	}
+
+	if o.localPort != 0 {
+		// connect through the caller's SSH tunnel
+		f.Config.Database.Host = "127.0.0.1"
+		f.Config.Database.Port = o.localPort
+	}
+
+	m := migration{up: up, profile: profile, config: f, dsn: newPostgreSQLDSN(f), connectionInfo: o.connectionInfo}
+
+	if f.Config.Database.CreateSchemas {
+		for _, schema := range searchPathSchemas(m.dsn.SearchPath) {
+			err = validateIdentifier(schema)
+			if err != nil {
+				return migration{}, fmt.Errorf("search_path: %w", err)
+			}
+		}
+	}
+
+	// determine directory from config file
+	m.dir, m.cleanup, err = migrationDir(f, up)
+	if err != nil {
+		return migration{}, err
+	}
+	defer func() {
+		if err != nil {
+			m.cleanup()
+		}
+	}()
+
+	// readDDLFiles reads and returns sorted DDL files from the up or down directory
+	m.files, err = readDDLFiles(m.dir, f.namingScheme(), f.fileSuffix(up))
+	if err != nil {
+		if !up && f.Config.AllowEmptyDown && errors.Is(err, fs.ErrNotExist) {
+			return migration{}, fmt.Errorf("%w: %s does not exist and allowEmptyDown is set", ErrNoMigrations, m.dir)
+		}
+		return migration{}, err
+	}
+
+	if len(m.files) == 0 {
+		if !up && f.Config.AllowEmptyDown {
+			// forward only migrations, rolling back is a no-op
+			return migration{}, fmt.Errorf("%w in %s, allowEmptyDown is set", ErrNoMigrations, m.dir)
+		}
+		return migration{}, fmt.Errorf("there are no DDL files to process in %s", m.dir)
+	}
+	// the files are sorted, before any filtering this is the newest
+	localVersion := m.files[len(m.files)-1].fileNumber
+
+	// a rollback undoes the newest migration first
+	if !up {
+		sort.Sort(sort.Reverse(byFileNumber(m.files)))
+	}
+
+	if f.Config.BaselineVersion > 0 {
+		m.files = aboveBaseline(m.files, f.Config.BaselineVersion)
+		if len(m.files) == 0 {
+			return migration{}, fmt.Errorf("%w in %s above baselineVersion %d", ErrNoMigrations, m.dir, f.Config.BaselineVersion)
+		}
+	}
+
+	if len(f.Config.ExcludeFiles) > 0 || len(f.Config.IncludeOnly) > 0 {
+		m.files, err = filterFileList(m.files, m.dir, f.Config.ExcludeFiles, f.Config.IncludeOnly)
+		if err != nil {
+			return migration{}, err
+		}
+		if len(m.files) == 0 {
+			return migration{}, fmt.Errorf("%w in %s after applying excludeFiles and includeOnly", ErrNoMigrations, m.dir)
+		}
+	}
+
+	if !o.since.IsZero() {
+		m.files, err = filterSince(m.files, f.namingScheme(), o.since)
+		if err != nil {
+			return migration{}, err
+		}
+		if len(m.files) == 0 {
+			return migration{}, fmt.Errorf("%w in %s after %s", ErrNoMigrations, m.dir, o.since.Format(time.RFC3339))
+		}
+	}
+
+	if o.tag != "" {
+		var tagged []ddlFile
+		for _, df := range m.files {
+			if df.headers.hasTag(o.tag) {
+				tagged = append(tagged, df)
+			}
+		}
+		if len(tagged) == 0 {
+			return migration{}, fmt.Errorf("no files in %s are tagged %q", m.dir, o.tag)
+		}
+		m.files = tagged
+	}
+
+	if o.glob != "" {
+		m.files, err = filterGlob(m.files, o.glob)
+		if err != nil {
+			return migration{}, err
+		}
+		if len(m.files) == 0 {
+			return migration{}, fmt.Errorf("no files in %s match %q", m.dir, o.glob)
+		}
+	}
+
+	// every connection made for the migration goes through the SSH
+	// tunnel, when one is configured. It is only opened when the
+	// checks and tracking queries below connect or the caller runs
+	// psql, and is only kept open for the latter.
+	direct := f
+	connects := o.runsPSQL || f.Config.PSQL.ConnectAttempts > 1 || f.Config.Database.VerifyCurrentDatabase ||
+		(f.manifestPath() == "" && f.Config.Tracking.Enabled)
+	if o.localPort == 0 && connects {
+		f, m.closeTunnel, err = openTunnel(f)
+		if err != nil {
+			return migration{}, err
+		}
+		defer func() {
+			if err != nil {
+				m.closeTunnel()
+			}
+		}()
+		m.config = f
+		m.dsn = newPostgreSQLDSN(f)
+	}
+
+	// a pooler may reject the first connection, so confirm one can
+	// be made before anything else talks to the database
+	if f.Config.PSQL.ConnectAttempts > 1 {
+		err = connectWithRetry(m.dsn, f.Config.PSQL.ConnectAttempts)
+		if err != nil {
+			return migration{}, err
+		}
+	}
+
+	if f.Config.Database.VerifyCurrentDatabase {
+		err = verifyCurrentDatabase(m.dsn)
+		if err != nil {
+			return migration{}, err
+		}
+	}
+
+	// when tracking is enabled, only files which still need to be
+	// applied (up) or rolled back (down) are run
+	m.manifest = f.manifestPath()
+	if m.manifest != "" {
+		var tm trackingManifest
+		tm, err = readManifest(m.manifest)
+		if err != nil {
+			return migration{}, err
+		}
+		applied := tm.applied()
+		if f.Config.Tracking.AbortIfAhead {
+			err = checkNotAhead(maxFileNumber(applied), localVersion)
+			if err != nil {
+				return migration{}, err
+			}
+		}
+		var filtered []ddlFile
+		for _, df := range m.files {
+			if applied[df.fileNumber] != up {
+				filtered = append(filtered, df)
+			}
+		}
+		m.files = filtered
+		if len(m.files) == 0 {
+			return migration{}, fmt.Errorf("%w in %s", ErrNoMigrations, m.dir)
+		}
+	} else if f.Config.Tracking.Enabled {
+		for _, df := range m.files {
+			if df.dotted() {
+				return migration{}, fmt.Errorf("%s: dotted versions cannot be recorded in the tracking table", df.filename)
+			}
+		}
+		m.tracker, err = NewTracker(f)
+		if err != nil {
+			return migration{}, err
+		}
+		// a failed file must be fixed and resumed explicitly
+		var dirty string
+		dirty, err = m.tracker.Dirty()
+		if err != nil {
+			return migration{}, err
+		}
+		switch {
+		case dirty != "" && !o.resume:
+			return migration{}, fmt.Errorf("%w: %s failed in a previous run, fix it and resume", ErrDirty, dirty)
+		case dirty == "" && o.resume:
+			return migration{}, fmt.Errorf("nothing to resume: no failed file is recorded in %s", m.tracker.table())
+		}
+		if f.Config.Tracking.AbortIfAhead {
+			var current int
+			current, err = m.tracker.CurrentVersion()
+			if err != nil {
+				return migration{}, err
+			}
+			err = checkNotAhead(current, localVersion)
+			if err != nil {
+				return migration{}, err
+			}
+		}
+		m.files, err = m.tracker.filter(m.files, up)
+		if err != nil {
+			return migration{}, err
+		}
+		if o.lastBatch && !up {
+			m.files, err = m.tracker.lastBatchFiles(m.files, m.dir)
+			if err != nil {
+				return migration{}, err
+			}
+		}
+		if len(m.files) == 0 {
+			return migration{}, fmt.Errorf("%w in %s", ErrNoMigrations, m.dir)
+		}
+		// checksums recorded with each file let Preview detect
+		// applied files which were edited afterward
+		if up {
+			for i := range m.files {
+				m.files[i].checksum, err = fileChecksum(m.dir + "/" + m.files[i].filename)
+				if err != nil {
+					return migration{}, err
+				}
+			}
+		}
+		// all files applied by this run are recorded in one batch
+		m.batch, err = m.tracker.nextBatch()
+		if err != nil {
+			return migration{}, err
+		}
+	}
+
+	// only the files which will actually run need confirming
+	err = m.confirmDestructive(profile, o.confirmDestructive)
+	if err != nil {
+		return migration{}, err
+	}
+
+	// checked by the runners only, so the pending set can still be
+	// planned and hashed before it is approved
+	m.expectedHash = o.expectedHash
+	if m.expectedHash == "" && up {
+		m.expectedHash = os.Getenv(expectedHashEnv)
+	}
+
+	if m.closeTunnel != nil && !o.runsPSQL {
+		m.closeTunnel()
+		m.closeTunnel = nil
+		m.config = direct
+		m.dsn = newPostgreSQLDSN(direct)
+	}
+
+	return m, nil
+}
+
+// close removes the directory the files were extracted to and closes
+// the SSH tunnel, if any
+func (m migration) close() {
+	if m.cleanup != nil {
+		m.cleanup()
+	}
+	if m.closeTunnel != nil {
+		m.closeTunnel()
+	}
+}
+
+// tracking reports whether applied files are recorded in the tracking table
+func (m migration) tracking() bool {
+	return m.config.Config.Tracking.Enabled && m.manifest == ""
+}
+
+// connArgs returns the psql flags which set up the connection and
+// output, followed by any configured extra args
+func (m migration) connArgs() []string {
+	args := append(m.config.passwordArgs(), "-d", m.dsn.ConnectionURI())
+	if m.config.Config.PSQL.EchoQueries {
+		args = append(args, "--echo-queries")
+	}
+	args = append(args, m.config.outputArgs()...)
+	return append(args, m.config.Config.PSQL.ExtraArgs...)
+}
+
+// setupArgs returns the psql flags run once before any files
+func (m migration) setupArgs() []string {
+	var args []string
+	if m.config.Config.Database.CreateSchemas {
+		for _, schema := range searchPathSchemas(m.dsn.SearchPath) {
+			args = append(args, "-c", "CREATE SCHEMA IF NOT EXISTS "+quoteIdentifier(schema))
+		}
+	}
+	if m.tracking() || m.singleTransaction() {
+		// stop at the first error so only files which ran
+		// successfully are recorded in the tracking table and
+		// a failed transaction is not committed
+		args = append(args, "-v", "ON_ERROR_STOP=1")
+	}
+	if m.tracking() {
+		args = append(args, "-c", m.tracker.createTableSQL(), "-c", m.tracker.addChecksumSQL())
+	}
+	return args
+}
+
+// sessionArgs returns the psql flags which configure the session
+// before any files run in it
+func (m migration) sessionArgs() []string {
+	var args []string
+	if level := m.config.Config.PSQL.ClientMinMessages; level != "" {
+		args = append(args, "-c", "SET client_min_messages = "+level)
+	}
+	if level := m.config.Config.PSQL.IsolationLevel; level != "" {
+		args = append(args, "-c", "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL "+strings.ToUpper(level))
+	}
+	if m.config.Config.PSQL.FastUnsafe {
+		args = append(args, "-c", "SET synchronous_commit = off")
+	}
+	return args
+}
+
+// singleTransaction reports whether files are run in a transaction
+// for the migration's direction
+func (m migration) singleTransaction() bool {
+	return m.config.singleTransaction(m.up)
+}
+
+// fileArgs returns the psql flags which run a single file. A file with
+// a gograte:schema header runs with its search_path set to that schema.
+//
+// The tracking statements are placed around the file's -f flag so that,
+// inside a transaction (see args and RunEachFile), the file's DDL and
+// its tracking row commit or roll back together.
+func (m migration) fileArgs(df ddlFile) []string {
+	var args []string
+	if m.tracking() && m.up {
+		args = append(args, "-c", m.tracker.startSQL(df, m.batch))
+	}
+	if df.headers.schema != "" {
+		args = append(args, "-c", "SET search_path TO "+quoteIdentifier(df.headers.schema))
+	}
+	args = append(args, "-f", m.filePath(df))
+	if df.headers.schema != "" {
+		// back to the connection's search_path
+		args = append(args, "-c", "RESET search_path")
+	}
+	if m.tracking() {
+		args = append(args, "-c", m.tracker.recordSQL(df, m.up, m.batch))
+	}
+	return args
+}
+
+// args returns the psql args which run every file in one invocation.
+//
+// When singleTransaction is enabled, consecutive files are wrapped in
+// BEGIN and COMMIT, along with their tracking table rows. Files marked
+// with the no-transaction header are run between transactions. On an
+// error, ON_ERROR_STOP makes psql exit before COMMIT is sent, so the
+// server rolls back the whole transaction, not just the failed file.
+// The failed file is then named from psql's error output, see
+// failedFile.
+func (m migration) args() []string {
+	args := m.connArgs()
+	if m.connectionInfo == nil {
+		args = append(args, "-c", diagnosticQuery)
+	}
+	if m.config.Config.AdvisoryLock.Enabled {
+		args = append(args, "-c", m.config.advisoryLockSQL())
+	}
+	args = append(args, m.sessionArgs()...)
+	args = append(args, m.setupArgs()...)
+
+	var inTx bool
+	for _, df := range m.files {
+		tx := m.singleTransaction() && !df.headers.noTransaction
+		switch {
+		case tx && !inTx:
+			args = append(args, "-c", "BEGIN")
+		case !tx && inTx:
+			args = append(args, "-c", "COMMIT")
+		}
+		inTx = tx
+		args = append(args, m.fileArgs(df)...)
+	}
+	if inTx {
+		args = append(args, "-c", "COMMIT")
+	}
+
+	return args
+}
+
+// failedFile returns the file psql reported an error in, from the
+// psql:<file>:<line>: prefix of its error output
+func (m migration) failedFile(err error) (ddlFile, bool) {
+	var pe *PSQLError
+	if !errors.As(err, &pe) {
+		return ddlFile{}, false
+	}
+	for _, line := range strings.Split(pe.Output, "\n") {
+		if !strings.HasPrefix(line, "psql:") {
+			continue
+		}
+		for _, df := range m.files {
+			path := m.filePath(df)
+			abs, _ := filepath.Abs(path)
+			if strings.HasPrefix(line, "psql:"+path+":") || strings.HasPrefix(line, "psql:"+abs+":") {
+				return df, true
+			}
+		}
+	}
+	return ddlFile{}, false
+}
+
+// attributeFailure names the file which failed in err, when psql
+// reported one, and whether its transaction was rolled back
+func (m migration) attributeFailure(err error) error {
+	df, ok := m.failedFile(err)
+	if !ok {
+		return err
+	}
+	if m.singleTransaction() && !df.headers.noTransaction {
+		return fmt.Errorf("%s failed, its transaction was rolled back: %w", df.filename, err)
+	}
+	return fmt.Errorf("%s failed: %w", df.filename, err)
+}
+
+// reportConnection runs the diagnostic query on its own and passes
+// the result to the migration's connectionInfo func, if it has one
+func (m migration) reportConnection() error {
+	if m.connectionInfo == nil {
+		return nil
+	}
+	info, err := queryConnectionInfo(m.dsn)
+	if err != nil {
+		return err
+	}
+	m.connectionInfo(info)
+	return nil
+}
@@ -0,0 +1,444 @@
+package gograte
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestArgsSingleTransaction(t *testing.T) {
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.SingleTransaction = true
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+
+	args, err := PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	begin := indexOf(args, "-c", "BEGIN")
+	commit := indexOf(args, "-c", "COMMIT")
+	if begin == -1 || commit == -1 || commit < begin {
+		t.Fatalf("files are not wrapped in BEGIN and COMMIT: %q", args)
+	}
+	for i, a := range args {
+		if a == "-f" && (i < begin || i > commit) {
+			t.Fatalf("file %s is not inside the transaction: %q", args[i+1], args)
+		}
+		if a == "BEGIN" && i != begin+1 {
+			t.Fatalf("files are not run in one transaction: %q", args)
+		}
+	}
+}
+
+func TestArgsNoTransaction(t *testing.T) {
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+
+	args, err := PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexOf(args, "-c", "BEGIN") != -1 || indexOf(args, "-c", "COMMIT") != -1 {
+		t.Fatalf("files are wrapped in a transaction: %q", args)
+	}
+}
+
+func TestRunThirdFileFailsNothingCommitted(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.SingleTransaction = true
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql", "004-d.sql")
+	t.Setenv("FAKEPSQL_FAIL", "003-c.sql")
+
+	err := Run(true, testProfile)
+
+	var pe *PSQLError
+	if !errors.As(err, &pe) || pe.Code != PSQLExitScript {
+		t.Fatalf("want a *PSQLError with exit code %d, got %v", PSQLExitScript, err)
+	}
+	if !strings.HasPrefix(err.Error(), "003-c.sql failed, its transaction was rolled back") {
+		t.Errorf("error does not name the failed file: %v", err)
+	}
+
+	calls := psqlCalls(t, log)
+	if len(calls) != 1 {
+		t.Fatalf("want 1 psql call, got %d", len(calls))
+	}
+	run := calls[0]
+	for _, a := range run {
+		if a == "COMMIT" {
+			t.Fatalf("COMMIT was sent after the third file failed: %q", run)
+		}
+	}
+	if got := fileArgsOrder(run); strings.Join(got, ",") != "001-a.sql,002-b.sql,003-c.sql" {
+		t.Errorf("files run = %v, want psql to stop at the third", got)
+	}
+}
+
+func TestMissingDownScriptsDir(t *testing.T) {
+	for _, allowEmptyDown := range []bool{true, false} {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.AllowEmptyDown = allowEmptyDown
+			f.Config.DownScriptsDir = f.Config.MigrationScriptsDir + "/rollback"
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		_, err := Plan(false, testProfile)
+		if allowEmptyDown && !errors.Is(err, ErrNoMigrations) {
+			t.Errorf("allowEmptyDown set: err = %v, want ErrNoMigrations", err)
+		}
+		if !allowEmptyDown && (err == nil || errors.Is(err, ErrNoMigrations) || !strings.Contains(err.Error(), "does not exist")) {
+			t.Errorf("allowEmptyDown not set: err = %v, want the missing directory reported", err)
+		}
+	}
+}
+
+func TestEmptyDownDirectory(t *testing.T) {
+	for _, allowEmptyDown := range []bool{true, false} {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.AllowEmptyDown = allowEmptyDown
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		_, err := Plan(false, testProfile)
+		if allowEmptyDown != errors.Is(err, ErrNoMigrations) || err == nil {
+			t.Errorf("allowEmptyDown %t: err = %v", allowEmptyDown, err)
+		}
+	}
+}
+
+func TestArgsPasswordPrompt(t *testing.T) {
+	tests := []struct {
+		mode   string
+		flag   string
+		absent []string
+	}{
+		{mode: "", flag: "-w", absent: []string{"-W"}},
+		{mode: PasswordPromptNever, flag: "-w", absent: []string{"-W"}},
+		{mode: PasswordPromptAlways, flag: "-W", absent: []string{"-w"}},
+		{mode: PasswordPromptAuto, absent: []string{"-w", "-W"}},
+	}
+	for _, tt := range tests {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.PSQL.PasswordPrompt = tt.mode
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		args, err := PSQLArgs(true, testProfile)
+		if err != nil {
+			t.Fatalf("passwordPrompt %q: %v", tt.mode, err)
+		}
+		if tt.flag != "" && indexOf(args, tt.flag) == -1 {
+			t.Errorf("passwordPrompt %q: %s missing from %q", tt.mode, tt.flag, args)
+		}
+		for _, flag := range tt.absent {
+			if indexOf(args, flag) != -1 {
+				t.Errorf("passwordPrompt %q: unexpected %s in %q", tt.mode, flag, args)
+			}
+		}
+	}
+
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.PasswordPrompt = "sometimes"
+	})
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil {
+		t.Error("invalid passwordPrompt accepted")
+	}
+}
+
+func TestArgsCreateSchemas(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.Database.SearchPath = "app, Sales, $user"
+			f.Config.Database.CreateSchemas = enabled
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		args, err := PSQLArgs(true, testProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := indexOf(args, "-f")
+		for _, stmt := range []string{"CREATE SCHEMA IF NOT EXISTS app", `CREATE SCHEMA IF NOT EXISTS "Sales"`} {
+			i := indexOf(args, "-c", stmt)
+			if enabled && (i == -1 || i > first) {
+				t.Errorf("%s is not run before the files: %q", stmt, args)
+			}
+			if !enabled && i != -1 {
+				t.Errorf("%s is run with createSchemas off: %q", stmt, args)
+			}
+		}
+		for _, a := range args {
+			if strings.Contains(a, "$user") {
+				t.Errorf("schema created for $user: %q", args)
+			}
+		}
+	}
+
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.Database.SearchPath = strings.Repeat("s", maxIdentifierLength+1)
+		f.Config.Database.CreateSchemas = true
+	})
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil {
+		t.Error("invalid schema identifier accepted")
+	}
+}
+
+func TestArgsTransactionPerDirection(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      func(f *ConfigFile)
+		up, down bool
+	}{
+		{name: "down only", set: func(f *ConfigFile) { f.Config.PSQL.SingleTransactionDown = true }, down: true},
+		{name: "up only", set: func(f *ConfigFile) { f.Config.PSQL.SingleTransactionUp = true }, up: true},
+		{name: "both", set: func(f *ConfigFile) { f.Config.PSQL.SingleTransaction = true }, up: true, down: true},
+		{name: "neither", set: func(f *ConfigFile) {}},
+	}
+	for _, tt := range tests {
+		scriptsDir := newTestProject(t, tt.set)
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+		writeFiles(t, scriptsDir+"/down", "001-a.sql")
+
+		for _, up := range []bool{true, false} {
+			args, err := PSQLArgs(up, testProfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.down
+			if up {
+				want = tt.up
+			}
+			if got := indexOf(args, "-c", "BEGIN") != -1; got != want {
+				t.Errorf("%s: up %t: transaction %t, want %t: %q", tt.name, up, got, want, args)
+			}
+		}
+	}
+}
+
+func TestArgsAutomationOutput(t *testing.T) {
+	automation := [][]string{{"-q"}, {"--pset", "pager=off"}, {"-v", "VERBOSITY=terse"}}
+	tests := []struct {
+		name string
+		set  func(f *ConfigFile)
+		want []bool
+	}{
+		{name: "default", set: func(f *ConfigFile) {}, want: []bool{false, false, false}},
+		{name: "automation", set: func(f *ConfigFile) { f.Config.PSQL.Output.Automation = true }, want: []bool{true, true, true}},
+		{name: "quiet", set: func(f *ConfigFile) { f.Config.PSQL.Output.Quiet = true }, want: []bool{true, false, false}},
+		{name: "pager off", set: func(f *ConfigFile) { f.Config.PSQL.Output.PagerOff = true }, want: []bool{false, true, false}},
+		{name: "terse", set: func(f *ConfigFile) { f.Config.PSQL.Output.Terse = true }, want: []bool{false, false, true}},
+	}
+	for _, tt := range tests {
+		scriptsDir := newTestProject(t, tt.set)
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		args, err := PSQLArgs(true, testProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := indexOf(args, "-f")
+		for i, flags := range automation {
+			at := indexOf(args, flags...)
+			if got := at != -1 && at < first; got != tt.want[i] {
+				t.Errorf("%s: %q before the files is %t, want %t: %q", tt.name, flags, got, tt.want[i], args)
+			}
+		}
+	}
+}
+
+func TestArgsClientMinMessages(t *testing.T) {
+	for _, level := range []string{"warning", ""} {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.PSQL.ClientMinMessages = level
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		args, err := PSQLArgs(true, testProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set := -1
+		for i, a := range args {
+			if strings.HasPrefix(a, "SET client_min_messages") {
+				set = i
+			}
+		}
+		switch {
+		case level == "" && set != -1:
+			t.Errorf("client_min_messages set by default: %q", args)
+		case level != "" && (set == -1 || args[set] != "SET client_min_messages = warning" || set > indexOf(args, "-f")):
+			t.Errorf("SET client_min_messages = warning is not run before the files: %q", args)
+		}
+	}
+
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.ClientMinMessages = "warning; drop table users"
+	})
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil {
+		t.Error("invalid client_min_messages level accepted")
+	}
+}
+
+func TestArgsFastUnsafe(t *testing.T) {
+	for _, fast := range []bool{true, false} {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.PSQL.FastUnsafe = fast
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		args, err := PSQLArgs(true, testProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set := indexOf(args, "-c", "SET synchronous_commit = off")
+		switch {
+		case !fast && set != -1:
+			t.Errorf("synchronous_commit set without fastUnsafe: %q", args)
+		case fast && (set == -1 || set > indexOf(args, "-f")):
+			t.Errorf("SET synchronous_commit = off is not run before the files: %q", args)
+		}
+	}
+
+	newTestProject(t, func(f *ConfigFile) {
+		f.Config.PSQL.FastUnsafe = true
+		f.Config.Protected = true
+	})
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil || !strings.Contains(err.Error(), "protected") {
+		t.Errorf("fastUnsafe accepted for a protected profile: %v", err)
+	}
+}
+
+func TestArgsIsolationLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  string
+	}{
+		{level: "read uncommitted", want: "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED"},
+		{level: "read committed", want: "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ COMMITTED"},
+		{level: "repeatable read", want: "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL REPEATABLE READ"},
+		{level: "serializable", want: "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE"},
+		{level: ""},
+	}
+	for _, tt := range tests {
+		scriptsDir := newTestProject(t, func(f *ConfigFile) {
+			f.Config.PSQL.IsolationLevel = tt.level
+		})
+		writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+		args, err := PSQLArgs(true, testProfile)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.level, err)
+		}
+		set := -1
+		for i, a := range args {
+			if strings.HasPrefix(a, "SET SESSION CHARACTERISTICS") {
+				set = i
+			}
+		}
+		switch {
+		case tt.level == "" && set != -1:
+			t.Errorf("isolation level set by default: %q", args)
+		case tt.level != "" && (set == -1 || args[set] != tt.want || args[set-1] != "-c" || set > indexOf(args, "-f")):
+			t.Errorf("%q is not run before the files: %q", tt.want, args)
+		}
+	}
+
+	for _, level := range []string{"SERIALIZABLE", "snapshot", "serializable; drop table users"} {
+		newTestProject(t, func(f *ConfigFile) {
+			f.Config.PSQL.IsolationLevel = level
+		})
+		_, err := PSQLArgs(true, testProfile)
+		if err == nil || !strings.Contains(err.Error(), "invalid psql isolationLevel") {
+			t.Errorf("isolation level %q accepted: %v", level, err)
+		}
+	}
+}
+
+func TestArgsDownScriptsDir(t *testing.T) {
+	reviewed := t.TempDir()
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.DownScriptsDir = reviewed
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+	// the derived down directory is ignored
+	writeFiles(t, scriptsDir+"/down", "001-a.sql", "002-b.sql", "003-stale.sql")
+	writeFiles(t, reviewed, "001-a.sql", "002-b.sql")
+
+	args, err := PSQLArgs(false, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for i, a := range args {
+		if a == "-f" {
+			files = append(files, args[i+1])
+		}
+	}
+	want := []string{reviewed + "/002-b.sql", reviewed + "/001-a.sql"}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("down files = %q, want %q", files, want)
+	}
+
+	args, err = PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range args {
+		if a == "-f" && !strings.HasPrefix(args[i+1], scriptsDir+"/up/") {
+			t.Errorf("up file %q is not read from the up directory", args[i+1])
+		}
+	}
+}
+
+func TestArgsDownScriptsDirDefault(t *testing.T) {
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/down", "001-a.sql")
+
+	args, err := PSQLArgs(false, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := indexOf(args, "-f"); i == -1 || args[i+1] != scriptsDir+"/down/001-a.sql" {
+		t.Errorf("down files are not read from the derived down directory: %q", args)
+	}
+}
+
+func TestDownScriptsDirValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      func(f *ConfigFile)
+		wantErr string
+	}{
+		{
+			name: "archive",
+			fn: func(f *ConfigFile) {
+				f.Config.DownScriptsDir = f.Config.MigrationScriptsDir + "/down.zip"
+			},
+			wantErr: "cannot be an archive",
+		},
+		{
+			name: "absolute without allowAbsoluteScriptsDir",
+			fn: func(f *ConfigFile) {
+				f.Config.DownScriptsDir = "/var/lib/rollbacks"
+				f.Config.AllowAbsoluteScriptsDir = false
+				f.Config.MigrationScriptsDir = "migrations"
+			},
+			wantErr: `downScriptsDir "/var/lib/rollbacks" is absolute`,
+		},
+	}
+	for _, tt := range tests {
+		newTestProject(t, tt.fn)
+		_, err := PSQLArgs(false, testProfile)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
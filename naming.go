@@ -0,0 +1,128 @@
+package gograte
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SequenceNaming is the default naming scheme where files are
+	// prefixed with a sequence number, e.g. 001-user.sql
+	SequenceNaming = "sequence"
+	// TimestampNaming is the naming scheme where files are prefixed
+	// with a UTC timestamp, e.g. 20240115093000-user.sql
+	TimestampNaming = "timestamp"
+	// FlywayNaming is the Flyway naming scheme where files are
+	// named V<version>__<description>.sql, e.g. V2__add_users.sql
+	// or V1.2__add_index.sql
+	FlywayNaming = "flyway"
+)
+
+// timestampLayout is the layout of a TimestampNaming file prefix
+const timestampLayout = "20060102150405"
+
+// sinceLayouts are the accepted formats for a since cutoff
+var sinceLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", timestampLayout}
+
+// ParseSince parses a cutoff time for WithSince. RFC 3339, a date
+// (2006-01-02), a date and time without zone (2006-01-02T15:04:05) and
+// the timestamp file prefix layout (20060102150405) are accepted.
+// Times without a zone are taken as UTC.
+func ParseSince(s string) (time.Time, error) {
+	for _, layout := range sinceLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid since cutoff %q: expected RFC 3339, 2006-01-02 or 20060102150405", s)
+}
+
+// fileTime returns the time encoded in a TimestampNaming file prefix
+func (df ddlFile) fileTime() (time.Time, error) {
+	t, err := time.Parse(timestampLayout, strconv.Itoa(df.fileNumber))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s does not have a %s timestamp prefix", df.filename, timestampLayout)
+	}
+	return t, nil
+}
+
+// filterSince returns the files with a timestamp prefix after since.
+// It is an error to filter files which do not use TimestampNaming.
+func filterSince(ddlFiles []ddlFile, namingScheme string, since time.Time) ([]ddlFile, error) {
+	if namingScheme != TimestampNaming {
+		return nil, fmt.Errorf("since filtering requires the %q naming scheme, config has %q", TimestampNaming, namingScheme)
+	}
+
+	var filtered []ddlFile
+	for _, df := range ddlFiles {
+		t, err := df.fileTime()
+		if err != nil {
+			return nil, err
+		}
+		if t.After(since) {
+			filtered = append(filtered, df)
+		}
+	}
+	return filtered, nil
+}
+
+// newFlywayDDLFile initializes a ddlFile from a FlywayNaming file name.
+// The version between the leading V and the double underscore may be
+// dotted (V1.2__) and, as in Flyway, underscores in the version are
+// treated as dots (V1_2__). The fileNumber is the first component.
+func newFlywayDDLFile(name string) (ddlFile, error) {
+	i := strings.Index(name, "__")
+	if !strings.HasPrefix(name, "V") || i < 2 {
+		return ddlFile{}, fmt.Errorf("%s does not match the Flyway naming convention V<version>__<description>.sql", name)
+	}
+
+	parts := strings.Split(strings.ReplaceAll(name[1:i], "_", "."), ".")
+	version := make([]int, len(parts))
+	for j, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return ddlFile{}, fmt.Errorf("%s has an invalid Flyway version %q", name, name[1:i])
+		}
+		version[j] = n
+	}
+
+	return ddlFile{filename: name, fileNumber: version[0], version: version}, nil
+}
+
+// compareVersions compares two versions component by component,
+// returning -1, 0 or 1. A version which is a prefix of another sorts
+// first (1 < 1.1).
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// versionKey returns the file's version as a string, e.g. 1.2
+func (df ddlFile) versionKey() string {
+	parts := make([]string, len(df.version))
+	for i, n := range df.version {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// dotted reports whether the file has a multi component version
+func (df ddlFile) dotted() bool {
+	return len(df.version) > 1
+}
@@ -0,0 +1,58 @@
+package gograte
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewFlywayDDLFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		fileNumber int
+		version    []int
+	}{
+		{name: "V2__add_users.sql", fileNumber: 2, version: []int{2}},
+		{name: "V002__add_users.sql", fileNumber: 2, version: []int{2}},
+		{name: "V1.2__add_index.sql", fileNumber: 1, version: []int{1, 2}},
+		{name: "V1_2__add_index.sql", fileNumber: 1, version: []int{1, 2}},
+		{name: "V1.2.3__add_column.sql", fileNumber: 1, version: []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		df, err := newFlywayDDLFile(tt.name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if df.fileNumber != tt.fileNumber || !reflect.DeepEqual(df.version, tt.version) {
+			t.Errorf("%s: got file number %d and version %v, want %d and %v", tt.name, df.fileNumber, df.version, tt.fileNumber, tt.version)
+		}
+	}
+
+	for _, name := range []string{"2__add_users.sql", "V__add_users.sql", "Vx__add_users.sql", "V1-add_users.sql", "V1.__add_users.sql", "001-add_users.sql"} {
+		_, err := newFlywayDDLFile(name)
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestFlywayFilesRunInVersionOrder(t *testing.T) {
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.NamingScheme = FlywayNaming
+	})
+	writeFiles(t, scriptsDir+"/up", "V1.10__c.sql", "V2__add_users.sql", "V1.2__b.sql", "V1__a.sql")
+
+	args, err := PSQLArgs(true, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range fileArgsOrder(args) {
+		got = append(got, filepath.Base(f))
+	}
+	want := []string{"V1__a.sql", "V1.2__b.sql", "V1.10__c.sql", "V2__add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files run in order %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package gograte
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// migrationNameRegexp matches the description part of a new file name
+var migrationNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// defaultFileNumberWidth is the zero padded width of new sequence file
+// numbers when there are no existing files to take it from
+const defaultFileNumberWidth = 3
+
+// NewMigrationFiles creates an empty up and down file pair for a new
+// migration called name (e.g. add_users) in the profile's migration
+// scripts directory and returns their paths. The file name follows the
+// configured naming scheme:
+//
+//	sequence:  next number after the last up file, zero padded, 004-add_users.sql
+//	timestamp: current UTC time, 20240115093000-add_users.sql
+//	flyway:    next major version after the last up file, V5__add_users.sql
+//
+// For the suffix layout, both files are created in the scripts
+// directory, e.g. 004-add_users.up.sql and 004-add_users.down.sql.
+func NewMigrationFiles(profile, name string, opts ...Option) (upPath, downPath string, err error) {
+	o := newOptions(opts)
+	if !migrationNameRegexp.MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q: use lowercase letters, digits, dashes and underscores", name)
+	}
+
+	var f ConfigFile
+	f, err = loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return "", "", err
+	}
+	if isArchive(f.Config.MigrationScriptsDir) {
+		return "", "", fmt.Errorf("cannot create files in archive %s", f.Config.MigrationScriptsDir)
+	}
+
+	upDir := f.scriptsDir() + "/up"
+	downDir := f.scriptsDir() + "/down"
+	if f.Config.Layout == SuffixLayout {
+		upDir, downDir = f.scriptsDir(), f.scriptsDir()
+	}
+	if dir := f.downDir(); dir != "" {
+		downDir = dir
+	}
+
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(upDir, f.namingScheme(), f.fileSuffix(true))
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+
+	var filename string
+	switch f.namingScheme() {
+	case TimestampNaming:
+		filename = time.Now().UTC().Format(timestampLayout) + "-" + name + ".sql"
+	case FlywayNaming:
+		next := 1
+		if len(ddlFiles) > 0 {
+			next = ddlFiles[len(ddlFiles)-1].fileNumber + 1
+		}
+		filename = fmt.Sprintf("V%d__%s.sql", next, name)
+	default:
+		next, width := 1, f.Config.FileNumberWidth
+		if len(ddlFiles) > 0 {
+			last := ddlFiles[len(ddlFiles)-1]
+			next = last.fileNumber + 1
+			if width == 0 {
+				width = last.prefixWidth()
+			}
+		}
+		if width == 0 {
+			width = defaultFileNumberWidth
+		}
+		filename = fmt.Sprintf("%0*d-%s.sql", width, next, name)
+	}
+
+	upPath, downPath = upDir+"/"+filename, downDir+"/"+filename
+	if f.Config.Layout == SuffixLayout {
+		base := strings.TrimSuffix(filename, ".sql")
+		upPath, downPath = upDir+"/"+base+upSuffix, downDir+"/"+base+downSuffix
+	}
+	for _, p := range []string{upPath, downPath} {
+		err = createEmptyFile(p)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return upPath, downPath, nil
+}
+
+// createEmptyFile creates the file at path, and its directory, failing
+// if the file already exists
+func createEmptyFile(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	var file *os.File
+	file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,165 @@
+package gograte
+
+import "time"
+
+// Option configures optional behavior of PSQLArgs
+type Option func(*options)
+
+// options holds the values set by Option functions
+type options struct {
+	// since, when non-zero, restricts files to those with a
+	// timestamp prefix after it
+	since time.Time
+	// resume allows running against a dirty database, see Resume
+	resume bool
+	// lastBatch restricts a down migration to the most recent
+	// batch, see RollbackBatch
+	lastBatch bool
+	// confirmDestructive is asked to confirm destructive
+	// statements in protected profiles
+	confirmDestructive func([]DestructiveStatement) bool
+	// tag, when set, restricts files to those tagged with it
+	tag string
+	// glob, when set, restricts files to those whose name matches it
+	glob string
+	// expectedHash, when set, must match the hash of the files
+	expectedHash string
+	// connectionInfo, when set, is passed the result of the
+	// diagnostic query, which then runs on its own
+	connectionInfo func(ConnectionInfo)
+	// baseDir, when set, is the absolute project root the config
+	// and migration files are read from
+	baseDir string
+	// connectionOverride replaces the profile's connection fields
+	connectionOverride ConnectionOverride
+	// localPort, when set, is the local end of an SSH tunnel opened
+	// by the caller, which the migration connects through instead of
+	// opening its own
+	localPort int
+	// runsPSQL keeps the SSH tunnel, if any, open until the
+	// migration is closed, see withRunsPSQL
+	runsPSQL bool
+}
+
+// newOptions applies opts to a zero options struct
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithSince restricts the migration to files whose timestamp prefix
+// is after t. It requires the timestamp naming scheme.
+func WithSince(t time.Time) Option {
+	return func(o *options) {
+		o.since = t
+	}
+}
+
+// withLastBatch restricts a down migration to the files applied by the
+// most recent batch, see RollbackBatch
+func withLastBatch() Option {
+	return func(o *options) {
+		o.lastBatch = true
+	}
+}
+
+// withResume allows the migration to start from a failed file
+func withResume() Option {
+	return func(o *options) {
+		o.resume = true
+	}
+}
+
+// WithConfirmDestructive sets a callback which is asked to confirm
+// destructive statements (e.g. DROP TABLE) found in the files about to
+// run against a protected profile. The migration only proceeds if it
+// returns true.
+func WithConfirmDestructive(fn func([]DestructiveStatement) bool) Option {
+	return func(o *options) {
+		o.confirmDestructive = fn
+	}
+}
+
+// WithTag restricts the migration to files tagged with tag in a
+// "-- gograte:tags" header comment. At least one file must carry the
+// tag.
+func WithTag(tag string) Option {
+	return func(o *options) {
+		o.tag = tag
+	}
+}
+
+// WithGlob restricts the migration to files whose name matches the
+// glob pattern, in path.Match syntax, e.g. *-online-*.sql. The pattern
+// is matched against the file name only, not the directory. Files
+// still run in file number order. The pattern must be valid and match
+// at least one file.
+func WithGlob(pattern string) Option {
+	return func(o *options) {
+		o.glob = pattern
+	}
+}
+
+// WithConnectionInfo runs the diagnostic query, which reports the
+// database, user and server version psql connected to, as its own
+// step before any files run and passes the result to fn, instead of
+// printing it with the files' output. It separates what was connected
+// to from what the migrations did, e.g. for logging.
+func WithConnectionInfo(fn func(ConnectionInfo)) Option {
+	return func(o *options) {
+		o.connectionInfo = fn
+	}
+}
+
+// WithExpectedHash aborts the migration unless the hash of the files
+// about to run (see PendingSetHash) equals hash, so a production run
+// applies exactly the reviewed migrations. For up migrations, the
+// GOGRATE_EXPECTED_HASH environment variable is used when no hash is
+// given. Only functions which run the files check the hash, so the
+// set can still be planned and listed before it is approved.
+func WithExpectedHash(hash string) Option {
+	return func(o *options) {
+		o.expectedHash = hash
+	}
+}
+
+// WithBaseDir reads the config and migration files of a project rooted
+// at dir, which must be absolute, instead of the working directory.
+// ConfigDir and the relative paths in the config, e.g.
+// migrationScriptsDir, are resolved within dir, so a library consumer
+// can point at its own module's files wherever it runs from. Every
+// function which reads a profile accepts it.
+func WithBaseDir(dir string) Option {
+	return func(o *options) {
+		o.baseDir = dir
+	}
+}
+
+// WithConnectionOverride runs the migration against the connection
+// described by c, whose non-empty fields replace the profile's, e.g.
+// to target an ad hoc database from command line flags.
+func WithConnectionOverride(c ConnectionOverride) Option {
+	return func(o *options) {
+		o.connectionOverride = c
+	}
+}
+
+// withRunsPSQL marks the migration as run by the caller, so the SSH
+// tunnel, if any, is opened even when nothing else needs a connection
+// and stays open until the migration is closed
+func withRunsPSQL() Option {
+	return func(o *options) {
+		o.runsPSQL = true
+	}
+}
+
+// withLocalPort connects to the database through the SSH tunnel
+// listening on port of the loopback interface
+func withLocalPort(port int) Option {
+	return func(o *options) {
+		o.localPort = port
+	}
+}
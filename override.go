@@ -0,0 +1,78 @@
+package gograte
+
+import "fmt"
+
+// ConnectionOverride holds connection settings which replace those of
+// a profile for a single run, e.g. to target an ad hoc database from
+// command line flags without editing the config. Empty fields keep
+// the profile's value. Overrides are applied last, after DATABASE_URL.
+type ConnectionOverride struct {
+	Host     string
+	Port     int
+	Database string
+	User     string
+	// Password is only used with an overridden host, the profile's
+	// password is never sent to a different host. When it is empty,
+	// psql falls back to PGPASSWORD or the password file.
+	Password string
+}
+
+// validate ensures the override's port is usable and that a different
+// host is not paired with the profile's user by accident
+func (c ConnectionOverride) validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid connection override port %d", c.Port)
+	}
+	if c.Host != "" && c.User == "" {
+		return fmt.Errorf("connection override of host %q requires a user", c.Host)
+	}
+	if c.Password != "" && c.Host == "" {
+		return fmt.Errorf("connection override password requires a host")
+	}
+	return nil
+}
+
+// applyConnectionOverride replaces the connection fields of f with
+// those set in c
+func (f *ConfigFile) applyConnectionOverride(c ConnectionOverride) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	db := &f.Config.Database
+	if c.Host != "" {
+		if c.Host != db.Host {
+			db.Password = c.Password
+		}
+		db.Host = c.Host
+	}
+	if c.Port != 0 {
+		db.Port = c.Port
+	}
+	if c.Database != "" {
+		db.Name = c.Database
+	}
+	if c.User != "" {
+		db.User = c.User
+	}
+
+	return nil
+}
+
+// BuildDSNWithOverride is like BuildDSN, with the connection fields set
+// in c replacing the profile's. The result holds the password, which
+// KeywordValueConnectionString includes, so use Redacted to show the
+// target before running.
+func BuildDSNWithOverride(profile string, c ConnectionOverride, opts ...Option) (PostgreSQLDSN, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return PostgreSQLDSN{}, err
+	}
+	err = f.applyConnectionOverride(c)
+	if err != nil {
+		return PostgreSQLDSN{}, err
+	}
+	return newPostgreSQLDSN(f), nil
+}
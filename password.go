@@ -0,0 +1,68 @@
+package gograte
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// stdinPassword caches the password read from stdin, so it is only
+// read (or prompted for) once per process
+var stdinPassword struct {
+	once     sync.Once
+	password string
+	err      error
+}
+
+// passwordFromStdin returns the database password read from stdin.
+// When stdin is a terminal, the user is prompted on stderr and echo
+// is turned off while typing. Otherwise the first line of stdin is
+// used, e.g. echo "$SECRET" | mage up default.
+func passwordFromStdin() (string, error) {
+	stdinPassword.once.Do(func() {
+		stdinPassword.password, stdinPassword.err = readPassword(os.Stdin)
+	})
+	return stdinPassword.password, stdinPassword.err
+}
+
+// readPassword reads a password from the first line of in, prompting
+// and disabling echo when in is a terminal
+func readPassword(in *os.File) (string, error) {
+	fi, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	interactive := fi.Mode()&os.ModeCharDevice != 0
+	if interactive {
+		fmt.Fprint(os.Stderr, "Password: ")
+		if setEcho(in, false) == nil {
+			defer func() {
+				_ = setEcho(in, true)
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	var line string
+	line, err = bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading password from stdin: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// setEcho turns terminal echo on or off using stty
+func setEcho(in *os.File, on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = in
+	return cmd.Run()
+}
@@ -0,0 +1,97 @@
+package gograte
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// waitInterval is the time between connection attempts in WaitForDB
+const waitInterval = 500 * time.Millisecond
+
+// Ping confirms a connection can be established by running a trivial
+// query through psql.
+func Ping(dsn PostgreSQLDSN) error {
+	_, err := queryPSQL(dsn, "select 1")
+	return err
+}
+
+// WaitForDB polls the database for the given profile until a
+// connection succeeds or timeout elapses. It is meant as a readiness
+// gate for CI, where a fresh Postgres container is started just before
+// migrations run. On timeout, the last connection error is returned.
+func WaitForDB(profile string, timeout time.Duration, opts ...Option) error {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+
+	var (
+		dsn         PostgreSQLDSN
+		closeTunnel func()
+	)
+	dsn, closeTunnel, err = tunnelDSN(f)
+	if err != nil {
+		return err
+	}
+	defer closeTunnel()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = Ping(dsn)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(waitInterval).After(deadline) {
+			return fmt.Errorf("database not available after %s: %w", timeout, err)
+		}
+		time.Sleep(waitInterval)
+	}
+}
+
+// connectWithRetry runs the diagnostic query, retrying up to attempts
+// times in total with a doubling backoff starting at waitInterval. It
+// gets a connection pooler which briefly rejects the first connection
+// past connection setup. Only psql connection failures are retried.
+// The last error is returned if every attempt fails.
+func connectWithRetry(dsn PostgreSQLDSN, attempts int) error {
+	backoff := waitInterval
+	var err error
+	for i := 1; ; i++ {
+		_, err = queryPSQL(dsn, diagnosticQuery)
+		if err == nil {
+			return nil
+		}
+		if !isPSQLConnectionError(err) {
+			return err
+		}
+		if i >= attempts {
+			return fmt.Errorf("connection failed after %d attempts: %w", attempts, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// ConnectionInfo describes where a migration connected, as reported
+// by the diagnostic query
+type ConnectionInfo struct {
+	Database string `json:"database"`
+	User     string `json:"user"`
+	// Version is the server's version() string
+	Version string `json:"version"`
+}
+
+// queryConnectionInfo runs the diagnostic query on its own
+func queryConnectionInfo(dsn PostgreSQLDSN) (ConnectionInfo, error) {
+	rows, err := queryPSQL(dsn, diagnosticQuery)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+	if len(rows) != 1 || len(rows[0]) < 3 {
+		return ConnectionInfo{}, fmt.Errorf("unexpected result from diagnostic query")
+	}
+	// version() has no | separators, but is rejoined in case
+	return ConnectionInfo{Database: rows[0][0], User: rows[0][1], Version: strings.Join(rows[0][2:], "|")}, nil
+}
@@ -0,0 +1,151 @@
+package gograte
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExecutionPlan describes what a migration will do before it runs
+type ExecutionPlan struct {
+	// Up is the direction of the migration
+	Up bool
+	// Profile is the config profile the plan was resolved for
+	Profile string
+	// Dir is the directory the files are read from
+	Dir string
+	// Groups are the files in execution order, grouped by whether
+	// they run inside a transaction
+	Groups []PlanGroup
+}
+
+// PlanGroup is a run of consecutive files which share a transaction
+// mode
+type PlanGroup struct {
+	// Transaction is true when the files are wrapped in one
+	// transaction (see psql.singleTransaction)
+	Transaction bool
+	Files       []MigrationFile
+}
+
+// Plan resolves the migration for the given direction and profile,
+// applying every filter and ordering rule the run would, and returns
+// the files it would run, in order and grouped by transaction. Nothing
+// is executed.
+func Plan(up bool, profile string, opts ...Option) (ExecutionPlan, error) {
+	m, err := newMigration(up, profile, opts...)
+	if err != nil {
+		return ExecutionPlan{}, err
+	}
+	defer m.close()
+
+	p := ExecutionPlan{Up: up, Profile: profile, Dir: m.dir}
+	for i, df := range m.files {
+		tx := m.singleTransaction() && !df.headers.noTransaction
+		if i == 0 || p.Groups[len(p.Groups)-1].Transaction != tx {
+			p.Groups = append(p.Groups, PlanGroup{Transaction: tx})
+		}
+		g := &p.Groups[len(p.Groups)-1]
+		g.Files = append(g.Files, newMigrationFile(df, m.dir))
+	}
+
+	return p, nil
+}
+
+// DownPreview returns the down files a down migration for the given
+// profile would run, in the order they would run: descending file
+// number, newest first. When tracking is enabled, only files recorded
+// as applied are included. Nothing is executed.
+func DownPreview(profile string) ([]MigrationFile, error) {
+	m, err := newMigration(false, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close()
+
+	files := make([]MigrationFile, 0, len(m.files))
+	for _, df := range m.files {
+		files = append(files, newMigrationFile(df, m.dir))
+	}
+	return files, nil
+}
+
+// MigrationFileInfo is a MigrationFile along with what the file
+// system reports about it
+type MigrationFileInfo struct {
+	MigrationFile
+	// AbsPath is the absolute path of the file
+	AbsPath string
+	// Size is the size of the file in bytes
+	Size int64
+	// ModTime is the file's modification time
+	ModTime time.Time
+}
+
+// ListMigrations resolves the migration for the given direction and
+// profile like Plan and returns the files it would run, in order, with
+// each file's absolute path, size and modification time, to confirm
+// the expected files are picked up. Nothing is executed.
+func ListMigrations(up bool, profile string, opts ...Option) ([]MigrationFileInfo, error) {
+	m, err := newMigration(up, profile, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close()
+
+	infos := make([]MigrationFileInfo, 0, len(m.files))
+	for _, df := range m.files {
+		mfi := MigrationFileInfo{MigrationFile: newMigrationFile(df, m.dir)}
+
+		mfi.AbsPath, err = filepath.Abs(mfi.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var fi os.FileInfo
+		fi, err = os.Stat(mfi.Path)
+		if err != nil {
+			return nil, err
+		}
+		mfi.Size = fi.Size()
+		mfi.ModTime = fi.ModTime()
+
+		infos = append(infos, mfi)
+	}
+	return infos, nil
+}
+
+// Tree renders the plan as an indented tree
+func (p ExecutionPlan) Tree() string {
+	direction := "down"
+	if p.Up {
+		direction = "up"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s migration for profile %s from %s\n", direction, p.Profile, p.Dir)
+	for _, g := range p.Groups {
+		if g.Transaction {
+			b.WriteString("  transaction\n")
+		} else {
+			b.WriteString("  no transaction\n")
+		}
+		for _, mf := range g.Files {
+			fmt.Fprintf(&b, "    %s", mf.Filename)
+			if mf.NoTransaction {
+				b.WriteString(" (gograte:no-transaction)")
+			}
+			if mf.Schema != "" {
+				fmt.Fprintf(&b, " (schema %s)", mf.Schema)
+			}
+			if len(mf.Tags) > 0 {
+				fmt.Fprintf(&b, " (tags %s)", strings.Join(mf.Tags, ","))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
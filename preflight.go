@@ -0,0 +1,112 @@
+package gograte
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// databasePrivileges are the privileges has_database_privilege checks
+	databasePrivileges = map[string]bool{"CREATE": true, "CONNECT": true, "TEMPORARY": true, "TEMP": true}
+	// schemaPrivileges are the privileges has_schema_privilege checks
+	schemaPrivileges = map[string]bool{"CREATE": true, "USAGE": true}
+)
+
+// PreflightPermissions confirms the connecting user holds the
+// privileges DDL needs before any file runs, so a missing grant is
+// reported up front rather than as a permission denied error part way
+// through a run. Every missing privilege is reported in the returned
+// error.
+//
+// The privileges checked come from database.requiredPrivileges in the
+// config. By default, CONNECT is checked on the database (and CREATE
+// when createSchemas is set) and USAGE and CREATE on each schema in the
+// search_path. A schema which does not exist yet is skipped when
+// createSchemas is set, as it will be created.
+func PreflightPermissions(profile string, opts ...Option) error {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+
+	dbPrivs, schemaPrivs := f.requiredPrivileges()
+	for _, p := range dbPrivs {
+		if !databasePrivileges[p] {
+			return fmt.Errorf("invalid database privilege %q", p)
+		}
+	}
+	for _, p := range schemaPrivs {
+		if !schemaPrivileges[p] {
+			return fmt.Errorf("invalid schema privilege %q", p)
+		}
+	}
+
+	// each check is a row: the problem if it fails, whether it passed
+	var checks []string
+	for _, p := range dbPrivs {
+		checks = append(checks, fmt.Sprintf("select %s, has_database_privilege(current_database(), %s)", quoteLiteral(fmt.Sprintf("user %s lacks %s on database %s", f.Config.Database.User, p, f.Config.Database.Name)), quoteLiteral(p)))
+	}
+	dsn := newPostgreSQLDSN(f)
+	for _, schema := range searchPathSchemas(dsn.SearchPath) {
+		err = validateIdentifier(schema)
+		if err != nil {
+			return fmt.Errorf("search_path: %w", err)
+		}
+		exists := fmt.Sprintf("exists (select 1 from pg_namespace where nspname = %s)", quoteLiteral(schema))
+		if !f.Config.Database.CreateSchemas {
+			checks = append(checks, fmt.Sprintf("select %s, %s", quoteLiteral("schema "+schema+" does not exist"), exists))
+		}
+		for _, p := range schemaPrivs {
+			checks = append(checks, fmt.Sprintf("select %s, has_schema_privilege(%s, %s) where %s", quoteLiteral(fmt.Sprintf("user %s lacks %s on schema %s", f.Config.Database.User, p, schema)), quoteLiteral(schema), quoteLiteral(p), exists))
+		}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	var closeTunnel func()
+	dsn, closeTunnel, err = tunnelDSN(f)
+	if err != nil {
+		return err
+	}
+	defer closeTunnel()
+
+	var rows [][]string
+	rows, err = queryPSQL(dsn, strings.Join(checks, " union all "))
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, row := range rows {
+		if len(row) == 2 && row[1] != "t" {
+			problems = append(problems, row[0])
+		}
+	}
+
+	return problemsError("preflight permissions check failed", problems)
+}
+
+// requiredPrivileges returns the database and schema privileges to
+// check, applying the defaults for those not configured
+func (f ConfigFile) requiredPrivileges() (database, schema []string) {
+	req := f.Config.Database.RequiredPrivileges
+	database, schema = req.Database, req.Schema
+	if database == nil {
+		database = []string{"CONNECT"}
+		if f.Config.Database.CreateSchemas {
+			database = append(database, "CREATE")
+		}
+	}
+	if schema == nil {
+		schema = []string{"USAGE", "CREATE"}
+	}
+	for i := range database {
+		database[i] = strings.ToUpper(database[i])
+	}
+	for i := range schema {
+		schema[i] = strings.ToUpper(schema[i])
+	}
+	return database, schema
+}
@@ -0,0 +1,74 @@
+package gograte
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// psql exit codes, as documented in the psql man page
+const (
+	// PSQLExitFatal is returned for a fatal error of psql's own,
+	// e.g. bad usage, out of memory or a file not found
+	PSQLExitFatal = 1
+	// PSQLExitConnection is returned when the connection to the
+	// server went bad, including when it could not be made. These
+	// are usually worth retrying.
+	PSQLExitConnection = 2
+	// PSQLExitScript is returned when an error occurred in a script
+	// and ON_ERROR_STOP was set. Retrying will fail the same way.
+	PSQLExitScript = 3
+)
+
+// maxPSQLErrorOutput bounds how much of psql's stderr is kept in a
+// PSQLError, as a whole run's notices can be large. The end of the
+// output, where psql writes the error, is kept.
+const maxPSQLErrorOutput = 4096
+
+// PSQLError is returned when psql exits with a non-zero status. Code
+// is psql's exit code, one of PSQLExitFatal, PSQLExitConnection or
+// PSQLExitScript, so callers can use errors.As to decide whether to
+// retry. Output is psql's error output, possibly truncated from the
+// start.
+type PSQLError struct {
+	Code   int
+	Output string
+	Err    error
+}
+
+// Error returns the exit status followed by psql's output
+func (e *PSQLError) Error() string {
+	if e.Output == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Output)
+}
+
+// Unwrap returns the underlying *exec.ExitError
+func (e *PSQLError) Unwrap() error {
+	return e.Err
+}
+
+// newPSQLError returns err as a *PSQLError with the given output if
+// psql ran and exited with a non-zero status, otherwise err unchanged
+func newPSQLError(err error, output string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() <= 0 {
+		return err
+	}
+	output = strings.TrimSpace(output)
+	if len(output) > maxPSQLErrorOutput {
+		output = output[len(output)-maxPSQLErrorOutput:]
+		if i := strings.IndexByte(output, '\n'); i >= 0 {
+			output = output[i+1:]
+		}
+	}
+	return &PSQLError{Code: exitErr.ExitCode(), Output: output, Err: err}
+}
+
+// isPSQLConnectionError reports whether err is a psql connection failure
+func isPSQLConnectionError(err error) bool {
+	var pe *PSQLError
+	return errors.As(err, &pe) && pe.Code == PSQLExitConnection
+}
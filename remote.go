@@ -0,0 +1,145 @@
+package gograte
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remoteConfigTimeout bounds how long fetching a remote config may take
+const remoteConfigTimeout = 10 * time.Second
+
+// maxRemoteConfigSize is the largest remote config accepted, in bytes
+const maxRemoteConfigSize = 1 << 20
+
+// ConfigFetcher fetches the JSON content of a config file from a
+// remote location. Fetchers are registered per URL scheme with
+// RegisterConfigFetcher.
+type ConfigFetcher interface {
+	Fetch(ctx context.Context, u *url.URL) ([]byte, error)
+}
+
+// ConfigFetcherFunc adapts a function to a ConfigFetcher
+type ConfigFetcherFunc func(ctx context.Context, u *url.URL) ([]byte, error)
+
+// Fetch calls fn(ctx, u)
+func (fn ConfigFetcherFunc) Fetch(ctx context.Context, u *url.URL) ([]byte, error) {
+	return fn(ctx, u)
+}
+
+var (
+	fetchersMu sync.Mutex
+	// fetchers holds the ConfigFetcher for each URL scheme
+	fetchers = map[string]ConfigFetcher{
+		"http":  ConfigFetcherFunc(fetchHTTP),
+		"https": ConfigFetcherFunc(fetchHTTP),
+	}
+	// remoteConfigs caches fetched configs by URL, so a config is
+	// fetched once per process even though most operations load the
+	// profile more than once
+	remoteConfigs = make(map[string][]byte)
+)
+
+// RegisterConfigFetcher registers fetcher for config URLs with the
+// given scheme, e.g. "s3", replacing any fetcher already registered.
+// http and https are supported out of the box. Other schemes, such as
+// s3, need a fetcher using the provider's SDK and credentials.
+func RegisterConfigFetcher(scheme string, fetcher ConfigFetcher) {
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	fetchers[strings.ToLower(scheme)] = fetcher
+}
+
+// remoteConfigURL parses path as a remote config URL. ok is false for
+// local file paths.
+func remoteConfigURL(path string) (u *url.URL, ok bool) {
+	i := strings.Index(path, "://")
+	if i <= 0 {
+		return nil, false
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, false
+	}
+	return u, true
+}
+
+// readRemoteConfig fetches the config at u using the fetcher for its
+// scheme, caching the result
+func readRemoteConfig(u *url.URL) ([]byte, error) {
+	fetchersMu.Lock()
+	fetcher, ok := fetchers[strings.ToLower(u.Scheme)]
+	b, cached := remoteConfigs[u.String()]
+	fetchersMu.Unlock()
+
+	if cached {
+		return b, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("no config fetcher registered for scheme %q, register one with RegisterConfigFetcher", u.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteConfigTimeout)
+	defer cancel()
+
+	b, err := fetcher.Fetch(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("fetch config %s: %w", redactURL(u), err)
+	}
+
+	fetchersMu.Lock()
+	remoteConfigs[u.String()] = b
+	fetchersMu.Unlock()
+
+	return b, nil
+}
+
+// fetchHTTP fetches u with a GET request. Any status other than 200 is
+// an error, with 401 and 403 reported as authorization failures.
+func fetchHTTP(ctx context.Context, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var resp *http.Response
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("not authorized: %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var b []byte
+	b, err = io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("config is larger than %d bytes", maxRemoteConfigSize)
+	}
+	return b, nil
+}
+
+// redactURL returns u as a string with any userinfo password and the
+// query, which may hold a signature or token, removed
+func redactURL(u *url.URL) string {
+	r := *u
+	if r.User != nil {
+		r.User = url.User(r.User.Username())
+	}
+	r.RawQuery = ""
+	return r.String()
+}
@@ -0,0 +1,159 @@
+package gograte
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// schemaSnapshotSQL lists the columns and indexes in the schemas of
+// the connection's search_path, in a stable order
+const schemaSnapshotSQL = `select 'column', table_schema || '.' || table_name || '.' || column_name || ' ' || data_type || ' ' || is_nullable || ' ' || coalesce(column_default, '')
+from information_schema.columns where table_schema = any(current_schemas(false))
+union all
+select 'index', schemaname || '.' || indexname || ' ' || indexdef
+from pg_indexes where schemaname = any(current_schemas(false))
+order by 1, 2`
+
+// RoundTrip applies the pending up files for the given profile one at
+// a time and checks each one's down file reverses it: after the up
+// file runs, its down file is run and the schema (columns and indexes
+// in the search_path) must match the snapshot taken before the up
+// file, then the up file is run again and must reproduce the schema
+// it produced the first time. Every file which fails the round trip
+// is reported in the returned error.
+//
+// It is expensive and meant for CI against a disposable database.
+// Execution stops at the first file which fails to run, as later files
+// may depend on it.
+func RoundTrip(profile string, opts ...Option) error {
+	up, err := newMigration(true, profile, append(opts, withRunsPSQL())...)
+	if err != nil {
+		return err
+	}
+	defer up.close()
+	err = up.checkExpectedHash()
+	if err != nil {
+		return err
+	}
+
+	// down shares up's tunnel, which up closes
+	down := up
+	down.up = false
+	down.closeTunnel = nil
+	down.dir, down.cleanup, err = migrationDir(up.config, false)
+	if err != nil {
+		return err
+	}
+	defer down.close()
+	var downFiles []ddlFile
+	downFiles, err = readDDLFiles(down.dir, up.config.namingScheme(), up.config.fileSuffix(false))
+	if err != nil {
+		return err
+	}
+	downByVersion := make(map[string]ddlFile, len(downFiles))
+	for _, df := range downFiles {
+		downByVersion[df.versionKey()] = df
+	}
+	down.files = downFiles
+
+	for _, m := range []*migration{&up, &down} {
+		var cleanup func()
+		cleanup, err = m.render()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+
+	err = up.runSetup(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, df := range up.files {
+		downFile, ok := downByVersion[df.versionKey()]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: no down file", df.filename))
+			return problemsError("round trip failed", problems)
+		}
+
+		var before, applied, reverted, reapplied string
+		steps := []struct {
+			m        migration
+			df       ddlFile
+			snapshot *string
+		}{
+			{up, df, &applied},
+			{down, downFile, &reverted},
+			{up, df, &reapplied},
+		}
+
+		before, err = schemaSnapshot(up.dsn)
+		if err != nil {
+			return err
+		}
+		for _, step := range steps {
+			err = step.m.runFile(context.Background(), step.df)
+			if err == nil {
+				err = step.m.recordManifest(step.df)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", step.df.filename, err))
+				return problemsError("round trip failed", problems)
+			}
+			*step.snapshot, err = schemaSnapshot(up.dsn)
+			if err != nil {
+				return err
+			}
+		}
+
+		if reverted != before {
+			problems = append(problems, fmt.Sprintf("%s: down file does not restore the schema:\n%s", df.filename, snapshotDiff(before, reverted)))
+		}
+		if reapplied != applied {
+			problems = append(problems, fmt.Sprintf("%s: re-running the up file produces a different schema:\n%s", df.filename, snapshotDiff(applied, reapplied)))
+		}
+	}
+
+	return problemsError("round trip failed", problems)
+}
+
+// schemaSnapshot returns the schema snapshot for dsn as text
+func schemaSnapshot(dsn PostgreSQLDSN) (string, error) {
+	rows, err := queryPSQL(dsn, schemaSnapshotSQL)
+	if err != nil {
+		return "", fmt.Errorf("schema snapshot: %w", err)
+	}
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = strings.Join(row, " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// snapshotDiff lists the lines only in want (-) and only in got (+)
+func snapshotDiff(want, got string) string {
+	inWant := make(map[string]bool)
+	for _, l := range strings.Split(want, "\n") {
+		inWant[l] = true
+	}
+	inGot := make(map[string]bool)
+	for _, l := range strings.Split(got, "\n") {
+		inGot[l] = true
+	}
+
+	var diff []string
+	for _, l := range strings.Split(want, "\n") {
+		if l != "" && !inGot[l] {
+			diff = append(diff, "\t\t- "+l)
+		}
+	}
+	for _, l := range strings.Split(got, "\n") {
+		if l != "" && !inWant[l] {
+			diff = append(diff, "\t\t+ "+l)
+		}
+	}
+	return strings.Join(diff, "\n")
+}
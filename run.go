@@ -0,0 +1,356 @@
+package gograte
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stderrPrefix tags lines which psql wrote to stderr
+const stderrPrefix = "stderr: "
+
+// maxStreamLine is the longest line of psql output StreamPSQL passes
+// to fn, e.g. a wide row or a long NOTICE
+const maxStreamLine = 16 << 20
+
+// StreamPSQL runs psql with the given args (typically from PSQLArgs)
+// and calls fn for each line of output as psql produces it, giving
+// live feedback for long running migrations. Lines psql writes to
+// stderr are passed to fn prefixed with "stderr: ". Calls to fn are
+// never concurrent.
+//
+// If ctx is cancelled, the psql process is killed and the context
+// error is returned. A line longer than maxStreamLine stops fn being
+// called for that stream, whose remaining output is discarded so psql
+// can finish, and the error is returned.
+func StreamPSQL(ctx context.Context, args []string, fn func(line string)) error {
+	cmd := exec.CommandContext(ctx, "psql", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr io.ReadCloser
+	stderr, err = cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		scanErr error
+	)
+	scan := func(r io.Reader, prefix string) {
+		defer wg.Done()
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, maxStreamLine)
+		for s.Scan() {
+			mu.Lock()
+			fn(prefix + s.Text())
+			mu.Unlock()
+		}
+		if s.Err() != nil {
+			// psql blocks writing to a full pipe, so the rest
+			// must still be read for it to exit
+			_, _ = io.Copy(io.Discard, r)
+			mu.Lock()
+			scanErr = errors.Join(scanErr, fmt.Errorf("read psql output: %w", s.Err()))
+			mu.Unlock()
+		}
+	}
+
+	wg.Add(2)
+	go scan(stdout, "")
+	go scan(stderr, stderrPrefix)
+
+	// all output must be read before calling Wait, which closes the pipes
+	wg.Wait()
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return errors.Join(err, scanErr)
+}
+
+// Run runs the migration for the given direction and profile with a
+// single psql invocation using the args from PSQLArgs. psql's output
+// is written to stdout and stderr.
+//
+// When psql.includeScript is set, the files are run from a temporary
+// master script instead (see IncludeScript).
+func Run(up bool, profile string, opts ...Option) error {
+	return RunContext(context.Background(), up, profile, opts...)
+}
+
+// RunContext is Run with a context. When ctx is cancelled, e.g. by
+// signal.NotifyContext on Ctrl-C, psql is sent SIGTERM (and killed if
+// it has not exited after psqlWaitDelay) and the context error is
+// returned. The server rolls back the transaction psql had open when
+// the connection closes, so a file run in a transaction is never left
+// half applied. Without singleTransaction, statements already run by
+// the interrupted file stay committed, and with tracking enabled the
+// file remains recorded as dirty.
+//
+// When webhook.url is set, the outcome is POSTed to it once the files
+// have run (see WebhookPayload).
+func RunContext(ctx context.Context, up bool, profile string, opts ...Option) error {
+	m, err := newMigration(up, profile, append(opts, withRunsPSQL())...)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	err = m.checkExpectedHash()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = m.run(ctx)
+	m.notify(start, err)
+	return err
+}
+
+// run runs the migration's files for RunContext
+func (m migration) run(ctx context.Context) error {
+	err := m.reportConnection()
+	if err != nil {
+		return err
+	}
+	var cleanup func()
+	cleanup, err = m.render()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if m.manifest != "" {
+		// each file is recorded in the manifest as it succeeds
+		return m.runFiles(ctx, nil)
+	}
+	if m.config.Config.PSQL.IncludeScript {
+		return m.attributeFailure(m.runIncludeScript(ctx))
+	}
+	return m.attributeFailure(runPSQLContext(ctx, m.dsn, m.args()))
+}
+
+// psqlWaitDelay is how long psql is given to exit after SIGTERM when
+// its context is cancelled, before it is killed
+const psqlWaitDelay = 10 * time.Second
+
+// psqlCommand returns a command which runs psql with args. The
+// password, which is never part of the args, is passed to psql in the
+// PGPASSWORD environment variable so it is not visible in ps output.
+// The DSN's AppName is passed in PGAPPNAME.
+//
+// When ctx is cancelled, psql is sent SIGTERM so it can close its
+// connection, and killed if it has not exited after psqlWaitDelay.
+func psqlCommand(ctx context.Context, dsn PostgreSQLDSN, args []string) *exec.Cmd {
+	return pgCommand(ctx, "psql", dsn, args)
+}
+
+// pgCommand is psqlCommand for name, any PostgreSQL client program
+// which reads PGPASSWORD and PGAPPNAME, e.g. pg_dump
+func pgCommand(ctx context.Context, name string, dsn PostgreSQLDSN, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = psqlWaitDelay
+	cmd.Env = os.Environ()
+	if dsn.Password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+dsn.Password)
+	}
+	if dsn.AppName != "" {
+		cmd.Env = append(cmd.Env, "PGAPPNAME="+dsn.AppName)
+	}
+	return cmd
+}
+
+// runPSQL runs psql with the given args, writing its output to
+// stdout and stderr
+func runPSQL(dsn PostgreSQLDSN, args []string) error {
+	return runPSQLContext(context.Background(), dsn, args)
+}
+
+// runPSQLContext is runPSQL with a context, returning the context
+// error if ctx is cancelled. A failure is returned as a *PSQLError
+// holding the end of psql's error output.
+func runPSQLContext(ctx context.Context, dsn PostgreSQLDSN, args []string) error {
+	var stderr bytes.Buffer
+	cmd := psqlCommand(ctx, dsn, args)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return newPSQLError(err, stderr.String())
+	}
+	return nil
+}
+
+// RunEachFile runs each DDL file for the given direction and profile in
+// its own psql invocation, continuing past failures. Each file is run
+// with ON_ERROR_STOP so a SQL error fails that file, and every failure
+// is collected into the returned error along with psql's message.
+// Unlike PSQLArgs, where psql's exit status only reflects the last
+// problem, no failure is lost.
+//
+// When tracking is enabled, only files which succeed are recorded.
+func RunEachFile(up bool, profile string, opts ...Option) (err error) {
+	m, err := newMigration(up, profile, append(opts, withRunsPSQL())...)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	err = m.checkExpectedHash()
+	if err != nil {
+		return err
+	}
+	var cleanup func()
+	cleanup, err = m.render()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var release func() error
+	release, err = m.holdAdvisoryLock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+
+	err = m.runSetup(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, df := range m.files {
+		err = m.runFile(context.Background(), df)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", df.filename, err))
+			continue
+		}
+		err = m.recordManifest(df)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MigrationFileCount returns the number of files a migration for the
+// given direction and profile would run, after filtering by options
+// and, when tracking is enabled, by the tracking table.
+func MigrationFileCount(up bool, profile string, opts ...Option) (int, error) {
+	m, err := newMigration(up, profile, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer m.close()
+	return len(m.files), nil
+}
+
+// RunWithProgress runs each DDL file for the given direction and
+// profile in its own psql invocation, calling progress with the number
+// of files completed and the total after each file succeeds, including
+// the last one. It is meant for UIs which report e.g. "applied 3 of 7
+// files (42%)" during a long run.
+//
+// Each file is run with ON_ERROR_STOP and, unlike RunEachFile,
+// execution stops at the first failed file, which is named in the
+// returned error. When tracking is enabled, each file is recorded as
+// it succeeds.
+func RunWithProgress(up bool, profile string, progress func(done, total int), opts ...Option) error {
+	m, err := newMigration(up, profile, append(opts, withRunsPSQL())...)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	err = m.checkExpectedHash()
+	if err != nil {
+		return err
+	}
+	var cleanup func()
+	cleanup, err = m.render()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return m.runFiles(context.Background(), progress)
+}
+
+// runFiles runs each file in its own psql invocation, stopping at the
+// first failed file, and calls progress, if not nil, after each file.
+// The advisory lock, if enabled, is held throughout.
+func (m migration) runFiles(ctx context.Context, progress func(done, total int)) (err error) {
+	var release func() error
+	release, err = m.holdAdvisoryLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+
+	err = m.runSetup(ctx)
+	if err != nil {
+		return err
+	}
+
+	total := len(m.files)
+	for i, df := range m.files {
+		err = m.runFile(ctx, df)
+		if err != nil {
+			return fmt.Errorf("%s: %w", df.filename, err)
+		}
+		err = m.recordManifest(df)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+
+	return nil
+}
+
+// runSetup runs the setup statements (see setupArgs), if any, in their
+// own psql invocation ahead of files run one at a time
+func (m migration) runSetup(ctx context.Context) error {
+	setup := m.setupArgs()
+	if setup == nil {
+		return nil
+	}
+	return runPSQLContext(ctx, m.dsn, append(append(m.connArgs(), m.sessionArgs()...), setup...))
+}
+
+// runFile runs a single file in its own psql invocation with
+// ON_ERROR_STOP, in a transaction if enabled, returning psql's error
+// message with any error
+func (m migration) runFile(ctx context.Context, df ddlFile) error {
+	args := append(m.connArgs(), "-v", "ON_ERROR_STOP=1")
+	if m.singleTransaction() && !df.headers.noTransaction {
+		args = append(args, "--single-transaction")
+	}
+	args = append(args, m.sessionArgs()...)
+	args = append(args, m.fileArgs(df)...)
+	return runPSQLContext(ctx, m.dsn, args)
+}
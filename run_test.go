@@ -0,0 +1,119 @@
+package gograte
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunEachFileReturnsPSQLError(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, nil)
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	t.Setenv("FAKEPSQL_FAIL", "002-b.sql")
+
+	err := RunEachFile(true, testProfile)
+	var pe *PSQLError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a *PSQLError", err)
+	}
+	if pe.Code != PSQLExitScript {
+		t.Errorf("Code = %d, want %d", pe.Code, PSQLExitScript)
+	}
+	if !strings.Contains(pe.Output, "002-b.sql:1: ERROR") {
+		t.Errorf("Output = %q, want psql's error message", pe.Output)
+	}
+
+	var ran []string
+	for _, call := range psqlCalls(t, log) {
+		ran = append(ran, fileArgsOrder(call)...)
+	}
+	if len(ran) != 3 || !strings.HasSuffix(ran[2], "003-c.sql") {
+		t.Fatalf("ran %q, want every file run past the failure", ran)
+	}
+}
+
+func TestRunSetsPGAPPNAME(t *testing.T) {
+	tests := []struct {
+		name    string
+		appName string
+		want    string
+	}{
+		{name: "default", want: "PGAPPNAME=" + defaultApplicationName},
+		{name: "configured", appName: "deploy bot", want: "PGAPPNAME=deploy bot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := installFakePSQL(t)
+			scriptsDir := newTestProject(t, func(f *ConfigFile) {
+				f.Config.Database.ApplicationName = tt.appName
+			})
+			writeFiles(t, scriptsDir+"/up", "001-a.sql")
+			// the configured name wins over one inherited from the parent
+			t.Setenv("PGAPPNAME", "inherited")
+
+			err := Run(true, testProfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := psqlCalls(t, log)
+			if len(calls) != 1 {
+				t.Fatalf("psql ran %d times, want 1", len(calls))
+			}
+			if calls[0][0] != tt.want {
+				t.Errorf("psql environment has %q, want %q", calls[0][0], tt.want)
+			}
+			for _, a := range calls[0][1:] {
+				if strings.Contains(a, "application_name") {
+					t.Errorf("application_name is in the psql args: %q", a)
+				}
+			}
+		})
+	}
+}
+
+func TestPSQLCommandEnv(t *testing.T) {
+	dsn := PostgreSQLDSN{Password: "secret", AppName: "gograte"}
+	cmd := psqlCommand(context.Background(), dsn, nil)
+	if !slices.Contains(cmd.Env, "PGAPPNAME=gograte") {
+		t.Errorf("command environment has no PGAPPNAME=gograte")
+	}
+	if !slices.Contains(cmd.Env, "PGPASSWORD=secret") {
+		t.Errorf("command environment has no PGPASSWORD")
+	}
+	if slices.Contains(cmd.Args, "secret") {
+		t.Errorf("the password is in the command args: %q", cmd.Args)
+	}
+
+	cmd = psqlCommand(context.Background(), PostgreSQLDSN{}, nil)
+	for _, e := range cmd.Env {
+		if e == "PGAPPNAME=" || e == "PGPASSWORD=" {
+			t.Errorf("command environment has an empty %s", e)
+		}
+	}
+}
+
+func TestStreamPSQLLongLine(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nhead -c 100000 /dev/zero | tr '\\0' x\necho\necho done\n"
+	err := os.WriteFile(filepath.Join(dir, "psql"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var lines []string
+	err = StreamPSQL(context.Background(), nil, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || len(lines[0]) != 100000 || lines[1] != "done" {
+		t.Errorf("got %d lines, want the 100000 byte line and done", len(lines))
+	}
+}
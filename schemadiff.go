@@ -0,0 +1,157 @@
+package gograte
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// schemaObjectPrefix starts the comment pg_dump writes before each
+// object, e.g. "-- Name: users; Type: TABLE; Schema: public; Owner: app"
+const schemaObjectPrefix = "-- Name: "
+
+// CompareSchemas dumps the schemas of the databases for two profiles,
+// e.g. staging and prod, with DumpSchema and compares them, returning
+// a diff and whether they are identical. This catches environments
+// which drifted through manual changes or skipped migrations.
+//
+// Objects are compared by name, type and schema, so the order pg_dump
+// writes them in does not matter. The diff lists objects only in one
+// database and, for objects in both, the lines which differ. Owners are
+// not compared, as they commonly differ between environments.
+func CompareSchemas(profileA, profileB string, opts ...Option) (diff string, identical bool, err error) {
+	var dir string
+	dir, err = os.MkdirTemp("", "gograte-compare-")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(dir)
+
+	dumps := make([]string, 2)
+	for i, profile := range []string{profileA, profileB} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.sql", i))
+		err = dumpSchema(profile, path, []string{"--no-owner"}, opts...)
+		if err != nil {
+			return "", false, fmt.Errorf("dump schema for profile %s: %w", profile, err)
+		}
+		var b []byte
+		b, err = os.ReadFile(path)
+		if err != nil {
+			return "", false, err
+		}
+		dumps[i] = string(b)
+	}
+
+	diff = diffSchemaDumps(profileA, dumps[0], profileB, dumps[1])
+	return diff, diff == "", nil
+}
+
+// diffSchemaDumps compares two pg_dump schema dumps object by object,
+// returning "" if they define the same objects
+func diffSchemaDumps(nameA, a, nameB, b string) string {
+	objectsA, objectsB := schemaObjects(a), schemaObjects(b)
+
+	keys := make(map[string]bool)
+	for k := range objectsA {
+		keys[k] = true
+	}
+	for k := range objectsB {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var out []string
+	for _, k := range sorted {
+		linesA, inA := objectsA[k]
+		linesB, inB := objectsB[k]
+		switch {
+		case !inB:
+			out = append(out, fmt.Sprintf("only in %s: %s", nameA, k))
+		case !inA:
+			out = append(out, fmt.Sprintf("only in %s: %s", nameB, k))
+		default:
+			if d := lineDiff(linesA, linesB); len(d) > 0 {
+				out = append(out, "differs: "+k)
+				out = append(out, d...)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("--- %s\n+++ %s\n%s\n", nameA, nameB, strings.Join(out, "\n"))
+}
+
+// schemaObjects splits a pg_dump schema dump into the SQL lines of each
+// object, keyed by the name, type and schema from the comment pg_dump
+// writes before it. Comments, blank lines, the session settings before
+// the first object and psql meta-commands, e.g. \restrict, whose
+// arguments change with every dump, are left out.
+func schemaObjects(dump string) map[string][]string {
+	objects := make(map[string][]string)
+	var key string
+	for _, line := range strings.Split(dump, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, schemaObjectPrefix) {
+			key = strings.TrimPrefix(line, "-- ")
+			if i := strings.Index(key, "; Owner:"); i >= 0 {
+				key = key[:i]
+			}
+			// register objects without lines, e.g. an empty schema
+			objects[key] = objects[key]
+			continue
+		}
+		if key == "" || line == "" || strings.HasPrefix(line, "--") || strings.HasPrefix(line, `\`) {
+			continue
+		}
+		objects[key] = append(objects[key], line)
+	}
+	return objects
+}
+
+// lineDiff returns the lines removed from a (-) and added in b (+),
+// in order, based on their longest common subsequence. It is meant for
+// the few lines of a single schema object.
+func lineDiff(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "\t- "+a[i])
+			i++
+		default:
+			diff = append(diff, "\t+ "+b[j])
+			j++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,70 @@
+package gograte
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WriteRunScript writes a runnable shell script to outPath which
+// invokes psql with the same arguments PSQLArgs generates for the
+// given direction and profile. The script is meant for audit and for
+// manual execution in environments where mage is not available.
+//
+// The password is never written to the script. psql finds it on its
+// own, e.g. in the PGPASSWORD environment variable or ~/.pgpass, or
+// prompts for it when the configured passwordPrompt allows. The
+// application name gograte would connect with is exported in
+// PGAPPNAME. The file is written with 0755 permissions so it can be
+// executed directly. Like PSQLArgs, it refuses a profile with
+// sshTunnel set.
+func WriteRunScript(up bool, profile, outPath string, opts ...Option) error {
+	args, err := PSQLArgs(up, profile, opts...)
+	if err != nil {
+		return err
+	}
+
+	var dsn PostgreSQLDSN
+	dsn, err = BuildDSN(profile, opts...)
+	if err != nil {
+		return err
+	}
+
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# generated by gograte: %s migration for profile %q\n", direction, profile)
+	b.WriteString("# the database password is not included, psql reads it from PGPASSWORD or ~/.pgpass\n")
+	if dsn.AppName != "" {
+		fmt.Fprintf(&b, "export PGAPPNAME=%s\n", shellQuote(dsn.AppName))
+	}
+	b.WriteString("\n")
+	b.WriteString("psql")
+	for _, arg := range args {
+		b.WriteString(" \\\n  ")
+		b.WriteString(shellQuote(arg))
+	}
+	b.WriteString("\n")
+
+	err = os.WriteFile(outPath, []byte(b.String()), 0755)
+	if err != nil {
+		return err
+	}
+
+	// os.WriteFile does not change the mode of an existing file
+	return os.Chmod(outPath, 0755)
+}
+
+// shellQuote quotes s for safe use as a single POSIX shell word.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,", r))
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
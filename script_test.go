@@ -0,0 +1,49 @@
+package gograte
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRunScript(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Database.ApplicationName = "deploy bot"
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+	out := filepath.Join(t.TempDir(), "up.sh")
+
+	err := WriteRunScript(true, testProfile, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(b)
+	if strings.Contains(script, "secret") {
+		t.Errorf("the password was written to the script:\n%s", script)
+	}
+	if !strings.Contains(script, "export PGAPPNAME='deploy bot'\n") {
+		t.Errorf("PGAPPNAME is not exported:\n%s", script)
+	}
+
+	// the script runs without PGPASSWORD, e.g. with ~/.pgpass
+	cmd := exec.Command(out)
+	cmd.Env = append(os.Environ(), "PGPASSWORD=")
+	b, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, b)
+	}
+	calls := psqlCalls(t, log)
+	if len(calls) != 1 || calls[0][0] != "PGAPPNAME=deploy bot" {
+		t.Fatalf("psql did not run with PGAPPNAME: %q", calls)
+	}
+	if files := fileArgsOrder(calls[0]); len(files) != 1 || !strings.HasSuffix(files[0], "001-a.sql") {
+		t.Errorf("script ran %q, want 001-a.sql", files)
+	}
+}
@@ -0,0 +1,144 @@
+package gograte
+
+import (
+	"strings"
+)
+
+// SplitStatements splits the SQL content of a DDL file into individual
+// statements, for backends which cannot execute multiple statements in
+// a single call. Comments are stripped and statements are split on
+// semicolons, except where the semicolon is inside:
+//
+//   - a single quoted string literal, including escape strings such as E'it\'s'
+//   - a double quoted identifier
+//   - a dollar quoted body, e.g. $$ ... $$ or $fn$ ... $fn$
+//
+// Returned statements are trimmed, do not include the terminating
+// semicolon and empty statements are dropped.
+func SplitStatements(sql string) []string {
+	var (
+		statements []string
+		cur        strings.Builder
+	)
+
+	flush := func() {
+		stmt := strings.TrimSpace(cur.String())
+		if stmt != "" {
+			statements = append(statements, stmt)
+		}
+		cur.Reset()
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			// line comment runs to the end of the line
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				i = len(sql)
+				continue
+			}
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			// block comments nest in Postgres
+			i = skipBlockComment(sql, i)
+			cur.WriteByte(' ')
+		case c == '\'':
+			end := skipQuoted(sql, i, '\'', i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e'))
+			cur.WriteString(sql[i:end])
+			i = end
+		case c == '"':
+			end := skipQuoted(sql, i, '"', false)
+			cur.WriteString(sql[i:end])
+			i = end
+		case c == '$':
+			tag, ok := dollarTag(sql[i:])
+			if !ok {
+				cur.WriteByte(c)
+				i++
+				continue
+			}
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end == -1 {
+				// unterminated, keep the remainder as is
+				cur.WriteString(sql[i:])
+				i = len(sql)
+				continue
+			}
+			end = i + len(tag) + end + len(tag)
+			cur.WriteString(sql[i:end])
+			i = end
+		case c == ';':
+			flush()
+			i++
+		default:
+			cur.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+
+	return statements
+}
+
+// skipBlockComment returns the index just past the (possibly nested)
+// block comment starting at i
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for i < len(sql) {
+		switch {
+		case strings.HasPrefix(sql[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(sql[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// skipQuoted returns the index just past the quoted string or
+// identifier starting at i. A doubled quote is an escaped quote and,
+// for escape strings, so is a backslash followed by the quote.
+func skipQuoted(sql string, i int, quote byte, backslashEscapes bool) int {
+	for i++; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return i
+}
+
+// dollarTag returns the dollar quote tag (e.g. $$ or $body$) at the
+// start of s, if there is one
+func dollarTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case c == '$':
+			return s[:j+1], true
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+		case c >= '0' && c <= '9' && j > 1:
+		default:
+			// not a tag, e.g. a positional parameter like $1
+			return "", false
+		}
+	}
+	return "", false
+}
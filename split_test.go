@@ -0,0 +1,94 @@
+package gograte
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "statements",
+			sql:  "create table a (id int);\ncreate table b (id int);\n",
+			want: []string{"create table a (id int)", "create table b (id int)"},
+		},
+		{
+			name: "no trailing semicolon",
+			sql:  "select 1; select 2",
+			want: []string{"select 1", "select 2"},
+		},
+		{
+			name: "semicolon in string",
+			sql:  "insert into t values ('a;b'); select 1;",
+			want: []string{"insert into t values ('a;b')", "select 1"},
+		},
+		{
+			name: "doubled quote in string",
+			sql:  "select 'it''s; fine'; select 2;",
+			want: []string{"select 'it''s; fine'", "select 2"},
+		},
+		{
+			name: "escape string",
+			sql:  `select E'it\'s; fine'; select 2;`,
+			want: []string{`select E'it\'s; fine'`, "select 2"},
+		},
+		{
+			name: "backslash in standard string",
+			sql:  `select 'C:\'; select 2;`,
+			want: []string{`select 'C:\'`, "select 2"},
+		},
+		{
+			name: "semicolon in quoted identifier",
+			sql:  `create table "a;b" (id int); select 1;`,
+			want: []string{`create table "a;b" (id int)`, "select 1"},
+		},
+		{
+			name: "function body",
+			sql:  "create function f() returns int as $$\nbegin\n  perform 1;\n  return 1;\nend;\n$$ language plpgsql;\nselect f();\n",
+			want: []string{"create function f() returns int as $$\nbegin\n  perform 1;\n  return 1;\nend;\n$$ language plpgsql", "select f()"},
+		},
+		{
+			name: "tagged dollar quote around $$",
+			sql:  "do $fn$ begin execute $$select 1;$$; end $fn$; select 1;",
+			want: []string{"do $fn$ begin execute $$select 1;$$; end $fn$", "select 1"},
+		},
+		{
+			name: "positional parameter",
+			sql:  "prepare p as select $1; execute p(1);",
+			want: []string{"prepare p as select $1", "execute p(1)"},
+		},
+		{
+			name: "unterminated dollar quote",
+			sql:  "select $$abc; def",
+			want: []string{"select $$abc; def"},
+		},
+		{
+			name: "line comment",
+			sql:  "select 1; -- done; really\nselect 2;",
+			want: []string{"select 1", "select 2"},
+		},
+		{
+			name: "nested block comment",
+			sql:  "select /* a /* b; */ c; */ 1; select 2;",
+			want: []string{"select   1", "select 2"},
+		},
+		{
+			name: "empty statements",
+			sql:  ";;\n  ;\n-- only a comment\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitStatements(tt.sql)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
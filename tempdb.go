@@ -0,0 +1,120 @@
+package gograte
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// defaultMaintenanceDatabase is connected to when creating and dropping
+// a temporary database if database.maintenanceDatabase is not configured
+const defaultMaintenanceDatabase = "postgres"
+
+// tempDBPrefix starts the name of each database created by WithTempDB
+const tempDBPrefix = "gograte_test_"
+
+// maintenanceDatabase returns the configured maintenance database, or
+// the default
+func (f ConfigFile) maintenanceDatabase() string {
+	if f.Config.Database.MaintenanceDatabase != "" {
+		return f.Config.Database.MaintenanceDatabase
+	}
+	return defaultMaintenanceDatabase
+}
+
+// WithTempDB creates a uniquely named throwaway database, e.g.
+// gograte_test_3f9a0c1d2e4b5a69, on the server of the given profile,
+// runs the up migrations against it, then calls fn with its DSN so the
+// result can be verified, e.g. with RoundTrip style checks or queries.
+// The database is dropped afterwards, even if the migrations or fn
+// fail. It lets CI validate migrations without touching a real
+// database.
+//
+// The database is created and dropped from a connection to
+// database.maintenanceDatabase, postgres by default, so the user needs
+// the CREATEDB privilege. Protected profiles and profiles tracked in a
+// manifest are refused, as the manifest would record the throwaway
+// run. No webhook is sent.
+func WithTempDB(profile string, fn func(dsn PostgreSQLDSN) error, opts ...Option) (err error) {
+	o := newOptions(opts)
+	var f ConfigFile
+	f, err = loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+	if f.Config.Protected {
+		return fmt.Errorf("profile %q is protected, a temporary database cannot be created with it", profile)
+	}
+	if f.manifestPath() != "" {
+		return fmt.Errorf("profile %q tracks migrations in a manifest, a temporary database cannot be created with it", profile)
+	}
+
+	var name string
+	name, err = tempDBName()
+	if err != nil {
+		return err
+	}
+
+	// the maintenance connection and the migration share one tunnel
+	var (
+		maintenance ConfigFile
+		closeTunnel func()
+	)
+	maintenance, closeTunnel, err = openTunnel(f)
+	if err != nil {
+		return err
+	}
+	defer closeTunnel()
+
+	opts = append(opts, WithConnectionOverride(ConnectionOverride{Database: name}))
+	if f.Config.SSHTunnel.Host != "" {
+		opts = append(opts, withLocalPort(maintenance.Config.Database.Port))
+	}
+	tempDSN := newPostgreSQLDSN(maintenance)
+	tempDSN.DBName = name
+	maintenance.Config.Database.Name = f.maintenanceDatabase()
+	dsn := newPostgreSQLDSN(maintenance)
+
+	_, err = queryPSQL(dsn, "CREATE DATABASE "+quoteIdentifier(name))
+	if err != nil {
+		return fmt.Errorf("create temporary database: %w", err)
+	}
+	defer func() {
+		_, dropErr := queryPSQL(dsn, "DROP DATABASE IF EXISTS "+quoteIdentifier(name))
+		if dropErr != nil {
+			err = errors.Join(err, fmt.Errorf("drop temporary database %s: %w", name, dropErr))
+		}
+	}()
+
+	var m migration
+	m, err = newMigration(true, profile, append(opts, withRunsPSQL())...)
+	if errors.Is(err, ErrNoMigrations) {
+		return fn(tempDSN)
+	}
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	err = m.checkExpectedHash()
+	if err != nil {
+		return err
+	}
+	err = m.run(context.Background())
+	if err != nil {
+		return fmt.Errorf("migrate temporary database %s: %w", name, err)
+	}
+
+	return fn(tempDSN)
+}
+
+// tempDBName returns a new, random temporary database name
+func tempDBName() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return tempDBPrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+package gograte
+
+import (
+	"bytes"
+	"os"
+	"text/template"
+)
+
+// templateData returns the data DDL files are rendered with when
+// templates are enabled, e.g. {{.Config.Database.Name}} or
+// {{.Vars.tablespace}}
+func (f ConfigFile) templateData() map[string]any {
+	return map[string]any{
+		"Config": f.Config,
+		"Vars":   f.Config.Template.Vars,
+	}
+}
+
+// renderSQL renders the content of the DDL file at path as a
+// text/template. Errors name the file, e.g. "template: <path>:3:7:".
+// Referencing a missing var is an error rather than rendering
+// "<no value>" into the SQL.
+func (f ConfigFile) renderSQL(path string, content []byte) ([]byte, error) {
+	t, err := template.New(path).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	err = t.Execute(&b, f.templateData())
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// render writes each of the migration's files, rendered as a template,
+// to a temporary directory which psql then runs them from. It does
+// nothing unless templates are enabled for the profile. The returned
+// cleanup func removes the directory.
+func (m *migration) render() (cleanup func(), err error) {
+	cleanup = func() {}
+	if !m.config.Config.Template.Enabled {
+		return cleanup, nil
+	}
+
+	var dir string
+	dir, err = os.MkdirTemp("", "gograte-render-")
+	if err != nil {
+		return cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	for _, df := range m.files {
+		path := m.dir + "/" + df.filename
+		var b []byte
+		b, err = readSQLFile(path)
+		if err != nil {
+			cleanup()
+			return func() {}, err
+		}
+		b, err = m.config.renderSQL(path, b)
+		if err != nil {
+			cleanup()
+			return func() {}, err
+		}
+		err = os.WriteFile(dir+"/"+df.filename, b, 0600)
+		if err != nil {
+			cleanup()
+			return func() {}, err
+		}
+	}
+
+	m.renderDir = dir
+	return cleanup, nil
+}
+
+// filePath returns the path psql runs df from: the rendered copy when
+// templates are enabled, otherwise the file itself
+func (m migration) filePath(df ddlFile) string {
+	if m.renderDir != "" {
+		return m.renderDir + "/" + df.filename
+	}
+	return m.dir + "/" + df.filename
+}
@@ -0,0 +1,151 @@
+package gograte
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MigrationResult is the outcome of running a single file
+type MigrationResult struct {
+	Filename string        `json:"filename"`
+	Duration time.Duration `json:"duration"`
+	// Slow is set when Duration exceeded psql.slowFileThreshold
+	Slow bool `json:"slow"`
+}
+
+// RunReport summarizes a migration run by RunTimed
+type RunReport struct {
+	Up      bool   `json:"up"`
+	Profile string `json:"profile"`
+	// Results are the files which ran successfully, in order
+	Results []MigrationResult `json:"results"`
+	// Slowest is the result which took longest, zero if no file ran
+	Slowest MigrationResult `json:"slowest"`
+	// Elapsed is the total time of the run, including setup
+	Elapsed time.Duration `json:"elapsed"`
+	// Connection is where the run connected
+	Connection ConnectionInfo `json:"connection"`
+}
+
+// Summary returns a short description of the report, e.g.
+//
+//	applied 3 files in 2m4s, slowest 002-orders.sql took 1m58s
+func (r RunReport) Summary() string {
+	verb := "reverted"
+	if r.Up {
+		verb = "applied"
+	}
+	s := fmt.Sprintf("%s %d files in %s", verb, len(r.Results), r.Elapsed.Round(time.Millisecond))
+	if r.Slowest.Filename != "" {
+		s += fmt.Sprintf(", slowest %s took %s", r.Slowest.Filename, r.Slowest.Duration.Round(time.Millisecond))
+	}
+	return s
+}
+
+// RunTimed runs each DDL file for the given direction and profile in
+// its own psql invocation, like RunWithProgress, and times each file.
+// The returned report names the slowest file, which surfaces slow DDL
+// such as a table rewrite. When psql.slowFileThreshold is set, a
+// warning is written to stderr for each file which exceeds it.
+//
+// Execution stops at the first failed file. The report covers the
+// files which ran before the failure and is returned with the error.
+// As with RunContext, the outcome is POSTed to webhook.url if set.
+func RunTimed(up bool, profile string, opts ...Option) (r RunReport, err error) {
+	start := time.Now()
+	r = RunReport{Up: up, Profile: profile}
+
+	// the connection is recorded in the report, and still passed to
+	// any WithConnectionInfo func in opts
+	onConnect := newOptions(opts).connectionInfo
+	var m migration
+	m, err = newMigration(up, profile, append(opts, withRunsPSQL(), WithConnectionInfo(func(info ConnectionInfo) {
+		r.Connection = info
+		if onConnect != nil {
+			onConnect(info)
+		}
+	}))...)
+	if err != nil {
+		return r, err
+	}
+	defer m.close()
+	err = m.checkExpectedHash()
+	if err != nil {
+		return r, err
+	}
+	defer func() { m.notify(start, err) }()
+
+	err = m.reportConnection()
+	if err != nil {
+		return r, err
+	}
+
+	var threshold time.Duration
+	threshold, err = m.config.slowFileThreshold()
+	if err != nil {
+		return r, err
+	}
+
+	var cleanup func()
+	cleanup, err = m.render()
+	if err != nil {
+		return r, err
+	}
+	defer cleanup()
+
+	// the elapsed time is set however the run ends, r is a named result
+	defer func() { r.Elapsed = time.Since(start) }()
+
+	ctx := context.Background()
+	var release func() error
+	release, err = m.holdAdvisoryLock(ctx)
+	if err != nil {
+		return r, err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+
+	err = m.runSetup(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	for _, df := range m.files {
+		fileStart := time.Now()
+		err = m.runFile(ctx, df)
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", df.filename, err)
+		}
+		res := MigrationResult{Filename: df.filename, Duration: time.Since(fileStart)}
+		if threshold > 0 && res.Duration > threshold {
+			res.Slow = true
+			fmt.Fprintf(os.Stderr, "warning: %s took %s, longer than slowFileThreshold %s\n", df.filename, res.Duration.Round(time.Millisecond), threshold)
+		}
+		r.Results = append(r.Results, res)
+		if res.Duration > r.Slowest.Duration {
+			r.Slowest = res
+		}
+		err = m.recordManifest(df)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// slowFileThreshold parses psql.slowFileThreshold, 0 when it is not set
+func (f ConfigFile) slowFileThreshold() (time.Duration, error) {
+	s := strings.TrimSpace(f.Config.PSQL.SlowFileThreshold)
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid slowFileThreshold %q: use a positive duration such as 30s or 5m", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,510 @@
+package gograte
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTrackingTable is the tracking table name used when none is configured
+const defaultTrackingTable = "schema_migrations"
+
+// ErrNoMigrations is returned when there are no migration files left to run
+var ErrNoMigrations = errors.New("there are no migrations to process")
+
+// ErrDirty is returned when a previous run failed part way through,
+// leaving the failed file recorded as dirty in the tracking table
+var ErrDirty = errors.New("database is dirty")
+
+// ErrDatabaseAhead is returned, when tracking.abortIfAhead is set, if
+// the database has a migration applied which is newer than any local file
+var ErrDatabaseAhead = errors.New("database is ahead of local files")
+
+// checkNotAhead returns ErrDatabaseAhead if the applied version is
+// newer than the newest local file, e.g. when an older build is
+// deployed to a database already migrated by a newer one
+func checkNotAhead(applied, local int) error {
+	if applied > local {
+		return fmt.Errorf("%w: database is at version %d but local files only go to %d", ErrDatabaseAhead, applied, local)
+	}
+	return nil
+}
+
+// tableNameRegexp matches an unquoted, optionally schema qualified, table name
+var tableNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// MigrationFile is an exported view of a DDL file
+type MigrationFile struct {
+	// Filename is the base name of the file, e.g. 001-user.sql
+	Filename string
+	// FileNumber is the number parsed from the filename prefix
+	FileNumber int
+	// Path is the path of the file relative to the project root
+	Path string
+	// Author is taken from an optional "-- author:" header comment
+	Author string
+	// Ticket is taken from an optional "-- ticket:" header comment
+	Ticket string
+	// NoTransaction is set by a "-- gograte:no-transaction" header
+	// comment, the file is never run inside a transaction
+	NoTransaction bool
+	// Schema is set by a "-- gograte:schema <name>" header comment,
+	// the file runs with its search_path set to this schema
+	Schema string
+	// Tags are set by a "-- gograte:tags a,b" header comment
+	Tags []string
+}
+
+// newMigrationFile initializes a MigrationFile from a ddlFile found in dir
+func newMigrationFile(df ddlFile, dir string) MigrationFile {
+	return MigrationFile{
+		Filename:      df.filename,
+		FileNumber:    df.fileNumber,
+		Path:          dir + "/" + df.filename,
+		Author:        df.headers.author,
+		Ticket:        df.headers.ticket,
+		NoTransaction: df.headers.noTransaction,
+		Schema:        df.headers.schema,
+		Tags:          df.headers.tags,
+	}
+}
+
+// Tracker reads and writes the tracking table, which records the
+// migration files which have been applied to a database.
+type Tracker struct {
+	DSN   PostgreSQLDSN
+	Table string
+}
+
+// NewTracker initializes a Tracker from a ConfigFile. When a component
+// is configured, its name is appended to the table name, e.g.
+// schema_migrations_billing.
+func NewTracker(f ConfigFile) (Tracker, error) {
+	t := Tracker{DSN: newPostgreSQLDSN(f), Table: f.Config.Tracking.Table}
+	if t.Table == "" {
+		t.Table = defaultTrackingTable
+	}
+	// each component tracks its migrations in its own table
+	t.Table += f.componentSuffix()
+	if !tableNameRegexp.MatchString(t.Table) {
+		return Tracker{}, fmt.Errorf("invalid tracking table name %q", t.Table)
+	}
+	// Postgres silently truncates longer identifiers, which could make
+	// two components share a table
+	if name := t.Table[strings.LastIndex(t.Table, ".")+1:]; len(name) > maxIdentifierLength {
+		return Tracker{}, fmt.Errorf("tracking table name %q is longer than %d characters", t.Table, maxIdentifierLength)
+	}
+	return t, nil
+}
+
+// table returns the tracking table name, falling back to the default
+func (t Tracker) table() string {
+	if t.Table == "" {
+		return defaultTrackingTable
+	}
+	return t.Table
+}
+
+// createTableSQL returns the statement which creates the tracking table
+func (t Tracker) createTableSQL() string {
+	return fmt.Sprintf("create table if not exists %s (file_number integer primary key, filename text not null, batch integer not null, dirty boolean not null default false, applied_at timestamptz not null default now(), checksum text)", t.table())
+}
+
+// startSQL returns the statement run before an up file, which records
+// the file, and its checksum if known, as dirty. If the file fails,
+// the dirty row remains so the failure is known and can be resumed.
+func (t Tracker) startSQL(df ddlFile, batch int) string {
+	checksum := "null"
+	if df.checksum != "" {
+		checksum = quoteLiteral(df.checksum)
+	}
+	return fmt.Sprintf("insert into %s (file_number, filename, batch, dirty, checksum) values (%d, %s, %d, true, %s) on conflict (file_number) do update set filename = excluded.filename, batch = excluded.batch, dirty = true, checksum = excluded.checksum", t.table(), df.fileNumber, quoteLiteral(df.filename), batch, checksum)
+}
+
+// recordSQL returns the statement which records (up) or removes (down)
+// the given file in the tracking table once it has run successfully.
+// Files recorded by the same run share a batch number.
+func (t Tracker) recordSQL(df ddlFile, up bool, batch int) string {
+	if up {
+		return fmt.Sprintf("update %s set dirty = false, applied_at = now() where file_number = %d", t.table(), df.fileNumber)
+	}
+	return fmt.Sprintf("delete from %s where file_number = %d", t.table(), df.fileNumber)
+}
+
+// Exists reports whether the tracking table exists. An unqualified
+// table name is looked up in the schemas of the connection's
+// search_path. false is returned without error when it does not exist.
+func (t Tracker) Exists() (bool, error) {
+	schemaCond := "table_schema = any(current_schemas(false))"
+	table := t.table()
+	if i := strings.Index(table, "."); i != -1 {
+		schemaCond = "table_schema = " + quoteLiteral(table[:i])
+		table = table[i+1:]
+	}
+
+	rows, err := queryPSQL(t.DSN, fmt.Sprintf("select exists (select 1 from information_schema.tables where %s and table_name = %s)", schemaCond, quoteLiteral(table)))
+	if err != nil {
+		return false, err
+	}
+	return len(rows) == 1 && rows[0][0] == "t", nil
+}
+
+// TrackingTableExists reports whether the default tracking table
+// exists for the given connection. It lets callers tell a gograte
+// managed database from a legacy one before running any migrations.
+func TrackingTableExists(dsn PostgreSQLDSN) (bool, error) {
+	return Tracker{DSN: dsn}.Exists()
+}
+
+// Applied returns the set of file numbers recorded in the tracking
+// table as successfully applied. Dirty (failed) files are not
+// included. An empty set is returned if the table does not exist yet.
+func (t Tracker) Applied() (map[int]bool, error) {
+	ok, err := t.Exists()
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]bool)
+	if !ok {
+		return applied, nil
+	}
+
+	var rows [][]string
+	rows, err = queryPSQL(t.DSN, fmt.Sprintf("select file_number from %s where not dirty", t.table()))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		var n int
+		n, err = strconv.Atoi(row[0])
+		if err != nil {
+			return nil, err
+		}
+		applied[n] = true
+	}
+
+	return applied, nil
+}
+
+// Dirty returns the filename of the file which failed during the last
+// up run, or "" if the database is not dirty.
+func (t Tracker) Dirty() (string, error) {
+	ok, err := t.Exists()
+	if err != nil || !ok {
+		return "", err
+	}
+
+	var rows [][]string
+	rows, err = queryPSQL(t.DSN, fmt.Sprintf("select filename from %s where dirty order by file_number limit 1", t.table()))
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return rows[0][0], nil
+}
+
+// lastBatch returns the highest batch number in the tracking table,
+// or 0 if nothing has been applied.
+func (t Tracker) lastBatch() (int, error) {
+	ok, err := t.Exists()
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	var rows [][]string
+	rows, err = queryPSQL(t.DSN, fmt.Sprintf("select coalesce(max(batch), 0) from %s", t.table()))
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) != 1 {
+		return 0, fmt.Errorf("unexpected result reading last batch from %s", t.table())
+	}
+	return strconv.Atoi(rows[0][0])
+}
+
+// nextBatch returns the batch number for the next run
+func (t Tracker) nextBatch() (int, error) {
+	b, err := t.lastBatch()
+	if err != nil {
+		return 0, err
+	}
+	return b + 1, nil
+}
+
+// batchFiles returns the file numbers recorded in the given batch
+func (t Tracker) batchFiles(batch int) (map[int]bool, error) {
+	rows, err := queryPSQL(t.DSN, fmt.Sprintf("select file_number from %s where batch = %d", t.table(), batch))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		var n int
+		n, err = strconv.Atoi(row[0])
+		if err != nil {
+			return nil, err
+		}
+		files[n] = true
+	}
+	return files, nil
+}
+
+// CurrentVersion returns the highest file number recorded in the
+// tracking table, or 0 if nothing has been applied.
+func (t Tracker) CurrentVersion() (int, error) {
+	applied, err := t.Applied()
+	if err != nil {
+		return 0, err
+	}
+	return maxFileNumber(applied), nil
+}
+
+// maxFileNumber returns the highest file number in applied, or 0
+func maxFileNumber(applied map[int]bool) int {
+	var v int
+	for n := range applied {
+		if n > v {
+			v = n
+		}
+	}
+	return v
+}
+
+// filter returns the files which still need to run in the given
+// direction: unapplied files for up, applied files for down.
+func (t Tracker) filter(ddlFiles []ddlFile, up bool) ([]ddlFile, error) {
+	applied, err := t.Applied()
+	if err != nil {
+		return nil, err
+	}
+	var filtered []ddlFile
+	for _, df := range ddlFiles {
+		if applied[df.fileNumber] != up {
+			filtered = append(filtered, df)
+		}
+	}
+	return filtered, nil
+}
+
+// CurrentVersion returns the highest file number recorded in the
+// default tracking table for the given connection.
+func CurrentVersion(dsn PostgreSQLDSN) (int, error) {
+	return Tracker{DSN: dsn}.CurrentVersion()
+}
+
+// MigrationStatus describes the migration state of a database
+type MigrationStatus struct {
+	// CurrentVersion is the highest applied file number
+	CurrentVersion int
+	// Pending are the up files which have not yet been applied
+	Pending []MigrationFile
+	// LastAppliedAt is when the most recent migration was applied, or
+	// the zero time if none has been
+	LastAppliedAt time.Time
+	// PSQLVersion is the installed psql client version, e.g. 16.2
+	PSQLVersion string
+}
+
+// Status returns the MigrationStatus for the given profile by
+// comparing the up directory with the tracking table, or the tracking
+// manifest if one is configured. The tracking table is read from the
+// read replica, if one is configured.
+func Status(profile string, opts ...Option) (MigrationStatus, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	var t Tracker
+	t, err = NewTracker(f)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	var closeTunnel func()
+	t.DSN, closeTunnel, err = tunnelDSN(replicaConfig(f))
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	defer closeTunnel()
+
+	var (
+		dir     string
+		pending []ddlFile
+		applied map[int]bool
+		cleanup func()
+	)
+	dir, pending, applied, cleanup, err = readPending(f, t)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	defer cleanup()
+
+	s := MigrationStatus{CurrentVersion: maxFileNumber(applied)}
+	for _, df := range pending {
+		s.Pending = append(s.Pending, newMigrationFile(df, dir))
+	}
+
+	s.LastAppliedAt, err = lastApplied(f, t)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	var major, minor int
+	major, minor, err = PSQLVersion()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	s.PSQLVersion = fmt.Sprintf("%d.%d", major, minor)
+
+	return s, nil
+}
+
+// HasPending reports whether any up migrations for the given profile
+// have not been applied, according to the tracking table or the
+// tracking manifest if one is configured. Deploy pipelines can use it
+// to skip the migration job when nothing has changed. false is
+// returned without error when every up file has been applied. Like
+// Status, it reads from the read replica, if one is configured.
+func HasPending(profile string, opts ...Option) (bool, error) {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return false, err
+	}
+
+	var t Tracker
+	t, err = NewTracker(f)
+	if err != nil {
+		return false, err
+	}
+	var closeTunnel func()
+	t.DSN, closeTunnel, err = tunnelDSN(replicaConfig(f))
+	if err != nil {
+		return false, err
+	}
+	defer closeTunnel()
+
+	var (
+		pending []ddlFile
+		cleanup func()
+	)
+	_, pending, _, cleanup, err = readPending(f, t)
+	if err != nil {
+		return false, err
+	}
+	defer cleanup()
+
+	return len(pending) > 0, nil
+}
+
+// readPending returns the up files for f which have not been applied
+// according to t, or the tracking manifest if one is configured, after
+// the baselineVersion, excludeFiles and includeOnly filters a run
+// applies. The directory the files were read from and the applied file
+// numbers are returned with them. The caller must call cleanup, which
+// removes the directory if the files were extracted to it.
+func readPending(f ConfigFile, t Tracker) (dir string, pending []ddlFile, applied map[int]bool, cleanup func(), err error) {
+	dir, cleanup, err = migrationDir(f, true)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	var ddlFiles []ddlFile
+	ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(true))
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	ddlFiles = aboveBaseline(ddlFiles, f.Config.BaselineVersion)
+	if len(f.Config.ExcludeFiles) > 0 || len(f.Config.IncludeOnly) > 0 {
+		ddlFiles, err = filterFileList(ddlFiles, dir, f.Config.ExcludeFiles, f.Config.IncludeOnly)
+		if err != nil {
+			return "", nil, nil, nil, err
+		}
+	}
+
+	applied, err = appliedFiles(f, t)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+
+	for _, df := range ddlFiles {
+		if !applied[df.fileNumber] {
+			pending = append(pending, df)
+		}
+	}
+	return dir, pending, applied, cleanup, nil
+}
+
+// appliedFiles returns the file numbers recorded as applied in the
+// tracking manifest, if one is configured, otherwise by t
+func appliedFiles(f ConfigFile, t Tracker) (map[int]bool, error) {
+	path := f.manifestPath()
+	if path == "" {
+		return t.Applied()
+	}
+	tm, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return tm.applied(), nil
+}
+
+// lastApplied returns the time the most recent migration was recorded
+// as applied in the tracking manifest, if one is configured, otherwise
+// by t
+func lastApplied(f ConfigFile, t Tracker) (time.Time, error) {
+	path := f.manifestPath()
+	if path == "" {
+		return t.LastApplied()
+	}
+	tm, err := readManifest(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	for _, e := range tm.Applied {
+		if e.AppliedAt.After(last) {
+			last = e.AppliedAt
+		}
+	}
+	return last, nil
+}
+
+// queryPSQL runs a single statement through psql in unaligned,
+// tuples-only mode and returns the output rows split into fields.
+// The password, if any, is passed via PGPASSWORD.
+func queryPSQL(dsn PostgreSQLDSN, sql string) ([][]string, error) {
+	cmd := psqlCommand(context.Background(), dsn, []string{"-X", "-w", "-q", "-A", "-t", "-F", "|", "-v", "ON_ERROR_STOP=1", "-d", dsn.ConnectionURI(), "-c", sql})
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("psql: %w", newPSQLError(err, stderr.String()))
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		rows = append(rows, strings.Split(line, "|"))
+	}
+
+	return rows, nil
+}
+
+// quoteLiteral quotes s as a SQL string literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
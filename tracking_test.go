@@ -0,0 +1,70 @@
+package gograte
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHasPendingReadsReplica(t *testing.T) {
+	log := installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.Database.Replica.Host = "replica"
+		f.Config.Database.Replica.Port = 5433
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"where not dirty", "1"},
+	)
+
+	pending, err := HasPending(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending {
+		t.Error("HasPending = false, want true with 002-b.sql not applied")
+	}
+
+	calls := psqlCalls(t, log)
+	if len(calls) == 0 {
+		t.Fatal("psql was not run")
+	}
+	for _, call := range calls {
+		for _, a := range call {
+			if strings.HasPrefix(a, "postgresql://") && !strings.Contains(a, "@replica:5433/") {
+				t.Errorf("HasPending read from the primary: %s", a)
+			}
+		}
+	}
+}
+
+func TestStatusAppliesFileFilters(t *testing.T) {
+	installFakePSQL(t)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.ExcludeFiles = []string{"003-c.sql"}
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql", "002-b.sql", "003-c.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"max(applied_at)", "2024-01-02T03:04:05Z"},
+		[2]string{"where not dirty", `1\n2`},
+	)
+
+	s, err := Status(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Pending) != 0 {
+		t.Errorf("Pending = %v, want the excluded file left out", s.Pending)
+	}
+	var pending bool
+	pending, err = HasPending(testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending {
+		t.Error("HasPending = true, want the excluded file left out")
+	}
+}
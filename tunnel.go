@@ -0,0 +1,144 @@
+package gograte
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sshTunnelTimeout bounds how long the SSH tunnel may take to open
+const sshTunnelTimeout = 15 * time.Second
+
+// defaultSSHPort is the bastion's SSH port when none is configured
+const defaultSSHPort = 22
+
+// sshTunnel is an ssh process forwarding a local port to the database
+// through a bastion host
+type sshTunnel struct {
+	cmd       *exec.Cmd
+	exited    chan error
+	localPort int
+	closeOnce sync.Once
+}
+
+// openTunnel opens the SSH tunnel configured for f, if any, and
+// returns f changed to connect through it, along with a func which
+// closes the tunnel. The tunnel forwards to the host and port f
+// connects to, so DATABASE_URL and any overrides must already be
+// applied. Without a tunnel, f is returned as is.
+func openTunnel(f ConfigFile) (ConfigFile, func(), error) {
+	if f.Config.SSHTunnel.Host == "" {
+		return f, func() {}, nil
+	}
+
+	t, err := openSSHTunnel(f)
+	if err != nil {
+		return ConfigFile{}, nil, err
+	}
+	f.Config.Database.Host = "127.0.0.1"
+	f.Config.Database.Port = t.localPort
+
+	return f, t.close, nil
+}
+
+// tunnelDSN returns the DSN for f, connecting through the SSH tunnel
+// configured for f, if any, along with a func which closes the tunnel
+func tunnelDSN(f ConfigFile) (PostgreSQLDSN, func(), error) {
+	f, closeTunnel, err := openTunnel(f)
+	if err != nil {
+		return PostgreSQLDSN{}, nil, err
+	}
+	return newPostgreSQLDSN(f), closeTunnel, nil
+}
+
+// openSSHTunnel starts ssh forwarding a local port to the database
+// host and port through the configured bastion and waits until the
+// local port accepts connections. The system ssh client is used, like
+// psql, so the user's ssh config, known_hosts and ssh agent apply
+// without gograte reimplementing them, and gograte keeps to the
+// standard library rather than depending on golang.org/x/crypto/ssh.
+// ssh runs in batch mode and so never prompts.
+func openSSHTunnel(f ConfigFile) (*sshTunnel, error) {
+	c := f.Config.SSHTunnel
+	if c.User == "" {
+		return nil, fmt.Errorf("sshTunnel.user must be set with sshTunnel.host")
+	}
+
+	t := &sshTunnel{localPort: c.LocalPort, exited: make(chan error, 1)}
+	if t.localPort == 0 {
+		var err error
+		t.localPort, err = freeLocalPort()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	args := []string{
+		"-N",
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-L", fmt.Sprintf("127.0.0.1:%d:%s:%d", t.localPort, f.Config.Database.Host, f.Config.Database.Port),
+		"-p", strconv.Itoa(port),
+	}
+	if c.KeyPath != "" {
+		args = append(args, "-i", c.KeyPath)
+	}
+	args = append(args, c.User+"@"+c.Host)
+
+	t.cmd = exec.Command("ssh", args...)
+	t.cmd.Stderr = os.Stderr
+	err := t.cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("ssh tunnel to %s: %w", c.Host, err)
+	}
+	go func() { t.exited <- t.cmd.Wait() }()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(t.localPort))
+	deadline := time.Now().Add(sshTunnelTimeout)
+	for {
+		select {
+		case err = <-t.exited:
+			return nil, fmt.Errorf("ssh tunnel to %s exited: %v", c.Host, err)
+		default:
+		}
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return t, nil
+		}
+		if time.Now().After(deadline) {
+			t.close()
+			return nil, fmt.Errorf("ssh tunnel to %s did not open within %s", c.Host, sshTunnelTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// close stops the ssh process and waits for it to exit. It may be
+// called more than once.
+func (t *sshTunnel) close() {
+	t.closeOnce.Do(func() {
+		_ = t.cmd.Process.Kill()
+		<-t.exited
+	})
+}
+
+// freeLocalPort returns a port on the loopback interface which is
+// not in use
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,246 @@
+package gograte
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSHScript stands in for ssh in tests by running the test binary
+// as TestHelperSSH with the ssh args
+const fakeSSHScript = `#!/bin/sh
+GOGRATE_FAKE_SSH=1 exec "$FAKESSH_BINARY" -test.run='^TestHelperSSH$' -- "$@"
+`
+
+// TestHelperSSH is not a test, it is run as ssh by fakeSSHScript. It
+// logs its args to $FAKESSH_LOG, then accepts connections on the local
+// port of the -L forward until it is killed, like ssh -N. As it only
+// listens once the args are logged, a tunnel which opened is always in
+// the log.
+func TestHelperSSH(t *testing.T) {
+	if os.Getenv("GOGRATE_FAKE_SSH") != "1" {
+		return
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+
+	file, err := os.OpenFile(os.Getenv("FAKESSH_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString(strings.Join(args, " ") + "\n")
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var forward string
+	for i, a := range args {
+		if a == "-L" && i+1 < len(args) {
+			forward = args[i+1]
+		}
+	}
+	// 127.0.0.1:<local port>:<host>:<port>
+	parts := strings.Split(forward, ":")
+	if len(parts) != 4 {
+		t.Fatalf("unexpected -L %q", forward)
+	}
+	var l net.Listener
+	l, err = net.Listen("tcp", parts[0]+":"+parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var conn net.Conn
+		conn, err = l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+}
+
+// installFakeSSH puts fakeSSHScript on PATH and configures an SSH
+// tunnel through it on a free local port. It returns the ssh log path
+// and the local port.
+func installFakeSSH(t *testing.T, f *ConfigFile) (string, int) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	port, err = freeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := t.TempDir()
+	err = os.WriteFile(filepath.Join(bin, "ssh"), []byte(fakeSSHScript), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKESSH_BINARY", exe)
+	log := filepath.Join(bin, "ssh.log")
+	t.Setenv("FAKESSH_LOG", log)
+
+	f.Config.SSHTunnel.Host = "bastion"
+	f.Config.SSHTunnel.User = "jump"
+	f.Config.SSHTunnel.LocalPort = port
+	return log, port
+}
+
+func TestEveryConnectionUsesTunnel(t *testing.T) {
+	psqlLog := installFakePSQL(t)
+	var (
+		sshLog string
+		port   int
+	)
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		f.Config.Tracking.Enabled = true
+		f.Config.Database.Replica.Host = "replica"
+		sshLog, port = installFakeSSH(t, f)
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+	answerQueries(t,
+		[2]string{"select exists", "t"},
+		[2]string{"max(batch)", "0"},
+	)
+
+	calls := []struct {
+		name string
+		run  func() error
+	}{
+		{"Run", func() error { return Run(true, testProfile) }},
+		{"Status", func() error { _, err := Status(testProfile); return err }},
+		{"HasPending", func() error { _, err := HasPending(testProfile); return err }},
+		{"Exec", func() error { _, err := Exec(testProfile, "select 1"); return err }},
+		{"MarkApplied", func() error { _, err := MarkApplied(testProfile, 1); return err }},
+	}
+	for _, c := range calls {
+		err := c.run()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+	}
+
+	local := "@127.0.0.1:" + strconv.Itoa(port) + "/"
+	for _, call := range psqlCalls(t, psqlLog) {
+		for _, a := range call {
+			if strings.HasPrefix(a, "postgresql://") && !strings.Contains(a, local) {
+				t.Errorf("psql connected around the tunnel: %s", a)
+			}
+		}
+	}
+
+	b, err := os.ReadFile(sshLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnels := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(tunnels) != len(calls) {
+		t.Fatalf("opened %d tunnels for %d calls:\n%s", len(tunnels), len(calls), b)
+	}
+	for _, tunnel := range tunnels {
+		if !strings.Contains(tunnel, "jump@bastion") {
+			t.Errorf("tunnel is not through the bastion: %s", tunnel)
+		}
+	}
+	if !strings.Contains(tunnels[1], ":replica:5432") {
+		t.Errorf("Status does not tunnel to the replica: %s", tunnels[1])
+	}
+}
+
+func TestRoundTripClosesTunnelOnce(t *testing.T) {
+	installFakePSQL(t)
+	var sshLog string
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		sshLog, _ = installFakeSSH(t, f)
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+	writeFiles(t, scriptsDir+"/down", "001-a.sql")
+
+	done := make(chan error, 1)
+	go func() { done <- RoundTrip(testProfile) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("RoundTrip did not return")
+	}
+
+	b, err := os.ReadFile(sshLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "jump@bastion"); n != 1 {
+		t.Errorf("opened %d tunnels, want 1:\n%s", n, b)
+	}
+}
+
+func TestReadOnlyCallsDoNotOpenTunnel(t *testing.T) {
+	psqlLog := installFakePSQL(t)
+	var sshLog string
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		sshLog, _ = installFakeSSH(t, f)
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+	calls := []struct {
+		name string
+		run  func() error
+	}{
+		{"Plan", func() error { _, err := Plan(true, testProfile); return err }},
+		{"IncludeScript", func() error { _, err := IncludeScript(true, testProfile); return err }},
+		{"PendingSetHash", func() error { _, err := PendingSetHash(true, testProfile); return err }},
+		{"MigrationFileCount", func() error { _, err := MigrationFileCount(true, testProfile); return err }},
+	}
+	for _, c := range calls {
+		err := c.run()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+	}
+
+	_, err := os.Stat(sshLog)
+	if !os.IsNotExist(err) {
+		t.Errorf("read-only calls opened a tunnel: %v", err)
+	}
+	if calls := psqlCalls(t, psqlLog); len(calls) != 0 {
+		t.Errorf("read-only calls ran psql %d times", len(calls))
+	}
+}
+
+func TestPSQLArgsRefusesTunnel(t *testing.T) {
+	installFakePSQL(t)
+	var sshLog string
+	scriptsDir := newTestProject(t, func(f *ConfigFile) {
+		sshLog, _ = installFakeSSH(t, f)
+	})
+	writeFiles(t, scriptsDir+"/up", "001-a.sql")
+
+	_, err := PSQLArgs(true, testProfile)
+	if err == nil || !strings.Contains(err.Error(), "sshTunnel") {
+		t.Fatalf("PSQLArgs error = %v, want sshTunnel refused", err)
+	}
+	err = WriteRunScript(true, testProfile, filepath.Join(t.TempDir(), "run.sh"))
+	if err == nil || !strings.Contains(err.Error(), "sshTunnel") {
+		t.Fatalf("WriteRunScript error = %v, want sshTunnel refused", err)
+	}
+	_, err = os.Stat(sshLog)
+	if !os.IsNotExist(err) {
+		t.Errorf("PSQLArgs opened a tunnel: %v", err)
+	}
+}
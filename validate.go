@@ -0,0 +1,72 @@
+package gograte
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+)
+
+// cueConfigPath is where the JSON config's top level config field is
+// unified with the #Config definition of schema.cue
+const cueConfigPath = "config"
+
+// ValidateConfigCUE checks the JSON config for the given profile
+// against config/cue/schema.cue and reports every violation with its
+// field path, e.g. config.database.host. schema.cue is the only
+// definition of the constraints, so validation cannot drift from it:
+// the config is unified with its #Config definition, as cue vet does
+// in CueGenConfig, using the CUE Go API, so the cue binary is not
+// needed.
+//
+// With WithBaseDir, the config and schema are read from the project
+// rooted at that directory.
+func ValidateConfigCUE(profile string, opts ...Option) error {
+	o := newOptions(opts)
+	err := validateBaseDir(o.baseDir)
+	if err != nil {
+		return err
+	}
+
+	configPath := profilePath(o.baseDir, profile)
+	var b []byte
+	b, err = readConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	schemaPath := inBaseDir(o.baseDir, cueDir+"/"+cueSchemaFile)
+	var schemaSrc []byte
+	schemaSrc, err = os.ReadFile(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(schemaSrc, cue.Filename(schemaPath))
+	if schema.Err() != nil {
+		return fmt.Errorf("compile %s: %w", schemaPath, schema.Err())
+	}
+	def := schema.LookupPath(cue.ParsePath("#Config"))
+	if !def.Exists() {
+		return fmt.Errorf("%s does not define #Config", schemaPath)
+	}
+
+	// JSON is valid CUE, so the config compiles as is
+	config := ctx.CompileBytes(b, cue.Filename(configPath))
+	if config.Err() != nil {
+		return fmt.Errorf("parse %s: %w", configPath, config.Err())
+	}
+
+	err = config.FillPath(cue.ParsePath(cueConfigPath), def).Validate(cue.Concrete(true))
+	if err != nil {
+		// reported as cue vet does, with each error's position
+		msg := strings.TrimSpace(cueerrors.Details(err, nil))
+		return problemsError(fmt.Sprintf("config for profile %s does not match the schema", profile), strings.Split(msg, "\n"))
+	}
+
+	return nil
+}
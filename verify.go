@@ -0,0 +1,257 @@
+package gograte
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EnsurePaired confirms that the set of file numbers in the up
+// directory exactly matches the set in the down directory for the
+// given profile. Every up file without a down file, and every down
+// file without an up file, is reported in the returned error.
+func EnsurePaired(profile string, opts ...Option) error {
+	o := newOptions(opts)
+	f, err := loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return err
+	}
+
+	var (
+		upDir, downDir         string
+		upCleanup, downCleanup func()
+	)
+	upDir, upCleanup, err = migrationDir(f, true)
+	if err != nil {
+		return err
+	}
+	defer upCleanup()
+	downDir, downCleanup, err = migrationDir(f, false)
+	if err != nil {
+		return err
+	}
+	defer downCleanup()
+
+	var upFiles, downFiles []ddlFile
+	upFiles, err = readDDLFiles(upDir, f.namingScheme(), f.fileSuffix(true))
+	if err != nil {
+		return err
+	}
+	downFiles, err = readDDLFiles(downDir, f.namingScheme(), f.fileSuffix(false))
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, df := range missingFileNumbers(upFiles, downFiles) {
+		problems = append(problems, fmt.Sprintf("%s/%s has no down file", upDir, df.filename))
+	}
+	for _, df := range missingFileNumbers(downFiles, upFiles) {
+		problems = append(problems, fmt.Sprintf("%s/%s has no up file", downDir, df.filename))
+	}
+
+	return problemsError("up and down files are not paired", problems)
+}
+
+// Verify runs all file checks for the given profile: up and down
+// files must be paired and neither directory may contain duplicate
+// file numbers or, for the sequence naming scheme, gaps in the
+// numbering sequence.
+//
+// File number padding problems (see widthWarnings) are returned as
+// warnings, unless strictFileNumberWidth is set in the config, in
+// which case they are reported in the error as well. Files starting
+// with a byte order mark, which psql -f may mishandle, are always
+// returned as warnings.
+func Verify(profile string, opts ...Option) (warnings []string, err error) {
+	o := newOptions(opts)
+	var f ConfigFile
+	f, err = loadProfileIn(o.baseDir, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems, encodingWarnings []string
+	for _, up := range []bool{true, false} {
+		var (
+			dir     string
+			cleanup func()
+		)
+		dir, cleanup, err = migrationDir(f, up)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		var ddlFiles []ddlFile
+		ddlFiles, err = readDDLFiles(dir, f.namingScheme(), f.fileSuffix(up))
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, sequenceProblems(dir, ddlFiles, f.namingScheme() == SequenceNaming)...)
+		// Flyway versions are not zero padded
+		if f.namingScheme() != FlywayNaming {
+			warnings = append(warnings, widthWarnings(dir, ddlFiles, f.Config.FileNumberWidth)...)
+		}
+		for _, df := range ddlFiles {
+			var w string
+			w, err = encodingWarning(dir + "/" + df.filename)
+			if err != nil {
+				return nil, err
+			}
+			if w != "" {
+				encodingWarnings = append(encodingWarnings, w)
+			}
+		}
+	}
+
+	if f.Config.StrictFileNumberWidth {
+		problems = append(problems, warnings...)
+	}
+	warnings = append(warnings, encodingWarnings...)
+
+	err = EnsurePaired(profile, opts...)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return warnings, problemsError("verification failed", problems)
+}
+
+// CompareProfiles compares the up and down files of two profiles,
+// which may point at different migrationScriptsDir trees (e.g. staging
+// carrying a migration prod does not yet have). Every file present in
+// one profile's directory but not the other's is reported in the
+// returned error, so divergence is caught before it causes surprises.
+func CompareProfiles(profileA, profileB string, opts ...Option) error {
+	o := newOptions(opts)
+	fa, err := loadProfileIn(o.baseDir, profileA)
+	if err != nil {
+		return err
+	}
+	var fb ConfigFile
+	fb, err = loadProfileIn(o.baseDir, profileB)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, up := range []bool{true, false} {
+		var (
+			dirA, dirB         string
+			cleanupA, cleanupB func()
+		)
+		dirA, cleanupA, err = migrationDir(fa, up)
+		if err != nil {
+			return err
+		}
+		defer cleanupA()
+		dirB, cleanupB, err = migrationDir(fb, up)
+		if err != nil {
+			return err
+		}
+		defer cleanupB()
+
+		var filesA, filesB []ddlFile
+		filesA, err = readDDLFiles(dirA, fa.namingScheme(), fa.fileSuffix(up))
+		if err != nil {
+			return err
+		}
+		filesB, err = readDDLFiles(dirB, fb.namingScheme(), fb.fileSuffix(up))
+		if err != nil {
+			return err
+		}
+
+		for _, df := range missingFilenames(filesA, filesB) {
+			problems = append(problems, fmt.Sprintf("%s/%s (%s) is not in %s (%s)", dirA, df.filename, profileA, dirB, profileB))
+		}
+		for _, df := range missingFilenames(filesB, filesA) {
+			problems = append(problems, fmt.Sprintf("%s/%s (%s) is not in %s (%s)", dirB, df.filename, profileB, dirA, profileA))
+		}
+	}
+
+	return problemsError(fmt.Sprintf("profiles %s and %s have diverged", profileA, profileB), problems)
+}
+
+// missingFilenames returns the files in a whose filename is not in b
+func missingFilenames(a, b []ddlFile) []ddlFile {
+	names := make(map[string]bool, len(b))
+	for _, df := range b {
+		names[df.filename] = true
+	}
+	var missing []ddlFile
+	for _, df := range a {
+		if !names[df.filename] {
+			missing = append(missing, df)
+		}
+	}
+	return missing
+}
+
+// missingFileNumbers returns the files in a whose version is not in b
+func missingFileNumbers(a, b []ddlFile) []ddlFile {
+	versions := make(map[string]bool, len(b))
+	for _, df := range b {
+		versions[df.versionKey()] = true
+	}
+	var missing []ddlFile
+	for _, df := range a {
+		if !versions[df.versionKey()] {
+			missing = append(missing, df)
+		}
+	}
+	return missing
+}
+
+// sequenceProblems reports duplicate file numbers and, if checkGaps
+// is true, gaps in the numbering of sorted ddlFiles found in dir
+func sequenceProblems(dir string, ddlFiles []ddlFile, checkGaps bool) []string {
+	var problems []string
+	for i := 1; i < len(ddlFiles); i++ {
+		prev, cur := ddlFiles[i-1], ddlFiles[i]
+		switch {
+		case compareVersions(cur.version, prev.version) == 0:
+			problems = append(problems, fmt.Sprintf("%s: %s and %s share file number %s", dir, prev.filename, cur.filename, cur.versionKey()))
+		case !checkGaps:
+			// gaps are only meaningful for sequence numbers
+		case cur.fileNumber > prev.fileNumber+1:
+			problems = append(problems, fmt.Sprintf("%s: gap in sequence between %s and %s", dir, prev.filename, cur.filename))
+		}
+	}
+	return problems
+}
+
+// widthWarnings reports files whose zero padded number prefix is not
+// width digits wide, and warns when the next file number would no
+// longer fit. If width is 0, the width of the first file is used as
+// the established padding.
+func widthWarnings(dir string, ddlFiles []ddlFile, width int) []string {
+	if len(ddlFiles) == 0 {
+		return nil
+	}
+	if width == 0 {
+		width = ddlFiles[0].prefixWidth()
+	}
+
+	var warnings []string
+	for _, df := range ddlFiles {
+		if w := df.prefixWidth(); w != width {
+			warnings = append(warnings, fmt.Sprintf("%s: %s has a %d digit file number, expected %d", dir, df.filename, w, width))
+		}
+	}
+
+	last := ddlFiles[len(ddlFiles)-1]
+	if next := strconv.Itoa(last.fileNumber + 1); len(next) > width {
+		warnings = append(warnings, fmt.Sprintf("%s: the next file number %s will not fit the %d digit padding, re-pad files before adding more", dir, next, width))
+	}
+
+	return warnings
+}
+
+// problemsError returns nil if there are no problems, otherwise an
+// error with msg followed by each problem on its own line
+func problemsError(msg string, problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s:\n\t%s", msg, strings.Join(problems, "\n\t"))
+}
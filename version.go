@@ -0,0 +1,76 @@
+package gograte
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// psqlVersionRegexp matches the version in psql --version output, e.g.
+// "psql (PostgreSQL) 16.2" or "psql (PostgreSQL) 9.6.24"
+var psqlVersionRegexp = regexp.MustCompile(`\(PostgreSQL\)\s+(\d+)(?:\.(\d+))?`)
+
+// psqlVersion caches the detected psql client version
+var psqlVersion struct {
+	once         sync.Once
+	major, minor int
+	err          error
+}
+
+// PSQLVersion returns the major and minor version of the installed psql
+// client, as reported by psql --version. The result is cached, so psql
+// is only run once per process.
+func PSQLVersion() (major, minor int, err error) {
+	psqlVersion.once.Do(func() {
+		var out []byte
+		out, psqlVersion.err = exec.Command("psql", "--version").Output()
+		if psqlVersion.err != nil {
+			psqlVersion.err = fmt.Errorf("psql --version: %w", psqlVersion.err)
+			return
+		}
+		psqlVersion.major, psqlVersion.minor, psqlVersion.err = parsePSQLVersion(string(out))
+	})
+	return psqlVersion.major, psqlVersion.minor, psqlVersion.err
+}
+
+// parsePSQLVersion parses the output of psql --version
+func parsePSQLVersion(s string) (major, minor int, err error) {
+	m := psqlVersionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, fmt.Errorf("cannot parse psql version from %q", strings.TrimSpace(s))
+	}
+	major, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		minor, _ = strconv.Atoi(m[2])
+	}
+	return major, minor, nil
+}
+
+// checkPSQLVersion returns an error if the installed psql client is
+// older than minVersion (e.g. "12" or "9.6"). An empty minVersion
+// skips the check.
+func checkPSQLVersion(minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+
+	wantMajor, wantMinor, err := parsePSQLVersion("(PostgreSQL) " + minVersion)
+	if err != nil {
+		return fmt.Errorf("invalid psql minVersion %q", minVersion)
+	}
+
+	var major, minor int
+	major, minor, err = PSQLVersion()
+	if err != nil {
+		return err
+	}
+
+	if major < wantMajor || major == wantMajor && minor < wantMinor {
+		return fmt.Errorf("psql %d.%d is installed, but at least %s is required", major, minor, minVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package gograte
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// webhookTimeout bounds how long posting to the webhook may take
+const webhookTimeout = 10 * time.Second
+
+// WebhookPayload is the JSON body POSTed to webhook.url after a
+// migration run. Fields are only ever added to it, never renamed or
+// removed, so receivers can rely on them.
+type WebhookPayload struct {
+	// Profile is the profile which was run
+	Profile string `json:"profile"`
+	// Direction is up or down
+	Direction string `json:"direction"`
+	// Files are the filenames the run attempted, in order
+	Files []string `json:"files"`
+	// Success is false if the run failed
+	Success bool `json:"success"`
+	// Error is the error message of a failed run
+	Error string `json:"error,omitempty"`
+	// DurationMS is how long the run took, in milliseconds
+	DurationMS int64 `json:"durationMs"`
+	// Text is a one line summary, which Slack incoming webhooks
+	// display as the message
+	Text string `json:"text"`
+}
+
+// newWebhookPayload builds the payload for a run of m which started
+// at start and ended with err
+func (m migration) newWebhookPayload(start time.Time, err error) WebhookPayload {
+	p := WebhookPayload{
+		Profile:    m.profile,
+		Direction:  "down",
+		Files:      make([]string, 0, len(m.files)),
+		Success:    err == nil,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if m.up {
+		p.Direction = "up"
+	}
+	for _, df := range m.files {
+		p.Files = append(p.Files, df.filename)
+	}
+
+	p.Text = fmt.Sprintf("gograte %s migration of %s: %d files run in %s", p.Direction, p.Profile, len(p.Files), time.Duration(p.DurationMS)*time.Millisecond)
+	if err != nil {
+		p.Error = err.Error()
+		p.Text = fmt.Sprintf("gograte %s migration of %s failed: %s", p.Direction, p.Profile, p.Error)
+	}
+	return p
+}
+
+// notify POSTs the outcome of the run to the configured webhook, if
+// any. Failures are written to stderr as a warning and otherwise
+// ignored, a migration never fails because it could not be announced.
+func (m migration) notify(start time.Time, runErr error) {
+	rawURL := m.config.Config.Webhook.URL
+	if rawURL == "" {
+		return
+	}
+	err := postWebhook(rawURL, m.newWebhookPayload(start, runErr))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: webhook: %v\n", err)
+	}
+}
+
+// postWebhook POSTs p as JSON to rawURL. Webhook URLs often embed a
+// secret, so only the host is named in errors.
+func postWebhook(rawURL string, p WebhookPayload) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.New("invalid url")
+	}
+
+	var b []byte
+	b, err = json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%s: invalid request", u.Host)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp *http.Response
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		// *url.Error repeats the full URL
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("%s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: unexpected status: %s", u.Host, resp.Status)
+	}
+	return nil
+}